@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// linkPassword takes a password of a public link from the header or, for
+// <img> tags which can't set headers, from the query
+func linkPassword(r *http.Request) string {
+	if password := r.Header.Get("X-Link-Password"); password != "" {
+		return password
+	}
+
+	return r.URL.Query().Get("password")
+}
+
+func fetchAlbumLinksRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	status, links := appDB.GetAlbumLinks(p.ByName("id"), userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+func addAlbumLinkRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	type Payload struct {
+		Password      string    `json:"password"`
+		AllowDownload bool      `json:"allowDownload"`
+		ExpiresAt     null.Time `json:"expiresAt"`
+	}
+	var payload Payload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a new link")
+
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, link, err := appDB.CreateAlbumLink(
+		p.ByName("id"),
+		userID,
+		payload.Password,
+		payload.AllowDownload,
+		payload.ExpiresAt,
+		db,
+	)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(link)
+	jsonResponse(w, status, string(response))
+}
+
+func deleteAlbumLinkRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	type Payload struct {
+		ID int `json:"id"`
+	}
+	var payload Payload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil || payload.ID == 0 {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a link to delete")
+
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status := appDB.DeleteAlbumLink(p.ByName("id"), userID, payload.ID, db)
+	jsonResponse(w, status, "")
+}
+
+func fetchLinkContentRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	enableCors(&w)
+	status, files, err := appDB.GetLinkContent(p.ByName("token"), linkPassword(r), db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func serveLinkFileRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("file"))
+	variant := p.ByName("variant")
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	original := variant == "original"
+	status, file, err := appDB.GetLinkFile(p.ByName("token"), linkPassword(r), fileID, original, db)
+	if err != nil || status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	serveFile(w, r, file, variant)
+}
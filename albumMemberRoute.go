@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type memberPayload struct {
+	User      int    `json:"user"`
+	Privilege string `json:"privilege"`
+}
+
+func parseMemberPayload(r *http.Request, userID int) (memberPayload, bool) {
+	var payload memberPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil || payload.User == 0 {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a member")
+
+		return payload, false
+	}
+
+	return payload, true
+}
+
+func memberResponse(w http.ResponseWriter, status int, err error) {
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	jsonResponse(w, status, "")
+}
+
+func fetchAlbumMembersRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	status, members := appDB.GetAlbumMembers(p.ByName("id"), userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func addAlbumMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	payload, ok := parseMemberPayload(r, userID)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, err := appDB.AddAlbumMember(p.ByName("id"), userID, payload.User, payload.Privilege, db)
+	memberResponse(w, status, err)
+}
+
+func changeAlbumMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	payload, ok := parseMemberPayload(r, userID)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, err := appDB.ChangeAlbumMember(p.ByName("id"), userID, payload.User, payload.Privilege, db)
+	memberResponse(w, status, err)
+}
+
+func removeAlbumMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	payload, ok := parseMemberPayload(r, userID)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status := appDB.RemoveAlbumMember(p.ByName("id"), userID, payload.User, db)
+	jsonResponse(w, status, "")
+}
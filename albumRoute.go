@@ -10,7 +10,7 @@ import (
 	appDB "photos/db"
 )
 
-func setAlbumCoverRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func setAlbumCoverRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
 	enableCors(&w)
 	albumID := p.ByName("id")
 
@@ -37,7 +37,7 @@ func setAlbumCoverRoute(w http.ResponseWriter, r *http.Request, p httprouter.Par
 	}
 }
 
-func addFilesToAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func addFilesToAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
 	enableCors(&w)
 	albumID := p.ByName("id")
 
@@ -57,7 +57,7 @@ func addFilesToAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.P
 	jsonResponse(w, status, "")
 }
 
-func fetchAlbumContentRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func fetchAlbumContentRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
 	enableCors(&w)
 	albumID := p.ByName("id")
 	files, err := appDB.GetAlbumContent(userID, albumID, db)
@@ -72,7 +72,7 @@ func fetchAlbumContentRoute(w http.ResponseWriter, r *http.Request, p httprouter
 	json.NewEncoder(w).Encode(files)
 }
 
-func fetchAlbumsRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func fetchAlbumsRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
 	enableCors(&w)
 	album, err := appDB.GetAlbums(userID, db)
 
@@ -86,7 +86,7 @@ func fetchAlbumsRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	json.NewEncoder(w).Encode(album)
 }
 
-func removeFromAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func removeFromAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
 	enableCors(&w)
 	albumID := p.ByName("id")
 
@@ -106,7 +106,7 @@ func removeFromAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.P
 	jsonResponse(w, status, "")
 }
 
-func addNewAlbumRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func addNewAlbumRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
 	enableCors(&w)
 	type Payload struct {
 		Name string `json:"name"`
@@ -126,7 +126,7 @@ func addNewAlbumRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Param
 	json.NewEncoder(w).Encode(album)
 }
 
-func deleteAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+func deleteAlbumRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
 	enableCors(&w)
 	albumID := p.ByName("id")
 
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// authHandle is a httprouter.Handle which gets id of the authenticated user
+type authHandle func(http.ResponseWriter, *http.Request, httprouter.Params, int)
+
+// bearerToken takes the token from `Authorization: Bearer <token>` header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+// authenticate resolves the caller and passes their id to the handle.
+// Requests without a valid session or API token get 401, API tokens
+// without the scope get 403. Empty scope accepts any valid credential
+func authenticate(scope string, handle authHandle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		userID, status, err := appDB.Authenticate(bearerToken(r), scope, db)
+		if err != nil {
+			enableCors(&w)
+			jsonResponse(w, status, errorMessage(err))
+			return
+		}
+
+		handle(w, r, p, userID)
+	}
+}
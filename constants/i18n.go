@@ -2,10 +2,44 @@ package constants
 
 // STRINGS should be used for i18n at later stage
 var STRINGS = map[string]string{
-	"noFile":               "No file",
-	"fileFormatInvalid":    "The format file is not valid.",
-	"uploadedSuccessfully": "File uploaded successfully!.",
-	"noAlbumName":          "Please provide name of album.",
-	"albumNameTaken":       "Name `%s` already exists. Please specify other for the album.",
-	"noAccessToAlbum":      "You don't have access to the album",
+	"noFile":                  "No file",
+	"fileFormatInvalid":       "The format file is not valid.",
+	"uploadedSuccessfully":    "File uploaded successfully!.",
+	"noAlbumName":             "Please provide name of album.",
+	"albumNameTaken":          "Name `%s` already exists. Please specify other for the album.",
+	"noAccessToAlbum":         "You don't have access to the album",
+	"missingUserData":         "Please provide first name, last name, email and password.",
+	"passwordTooShort":        "Password must be at least 8 characters long.",
+	"emailTaken":              "An account with this email already exists.",
+	"invalidCredentials":      "Invalid email or password.",
+	"unauthorized":            "Please log in.",
+	"insufficientScope":       "The token doesn't allow this action.",
+	"noTokenName":             "Please provide name of the token.",
+	"invalidScope":            "Unknown scope `%s`.",
+	"invalidPrivilege":        "Unknown privilege `%s`.",
+	"linkNotFound":            "The link doesn't exist or has expired.",
+	"linkPasswordInvalid":     "The link requires a valid password.",
+	"linkExpiresInPast":       "Expiration date must be in the future.",
+	"uploadLengthInvalid":     "Upload-Length must be a positive number.",
+	"uploadTooLarge":          "The file exceeds the maximum size of %d bytes.",
+	"uploadNotFound":          "The upload doesn't exist or has expired.",
+	"uploadOffsetMismatch":    "Upload-Offset doesn't match the received size.",
+	"uploadLocked":            "The upload is being written by another request.",
+	"fileSaveFailed":          "The file couldn't be saved, please try again.",
+	"sourceFileInvalid":       "Only images you can see can be combined.",
+	"collageFilesInvalid":     "A collage is made of %d to %d images.",
+	"collageLayoutInvalid":    "The collage layout is not valid.",
+	"animationFilesInvalid":   "An animation is made of %d to %d images.",
+	"sourcesTooLarge":         "Images combined at once can have at most %d bytes together.",
+	"animationOptionsInvalid": "The animation options are not valid.",
+	"rotationInvalid":         "An image can be rotated only by a multiple of 90 degrees.",
+	"videoNotEditable":        "Videos can't be edited.",
+	"editInvalid":             "The edit is not valid.",
+	"editsTooMany":            "A photo can have at most %d edits.",
+	"nothingToUndo":           "The photo has no edit to undo.",
+	"timelineGroupInvalid":    "The timeline is grouped by `day` or `month`.",
+	"timeZoneInvalid":         "Unknown time zone.",
+	"cursorInvalid":           "The cursor is not valid.",
+	"tagsTooMany":             "A file can have at most %d tags.",
+	"tagTooLong":              "A tag can have at most %d characters.",
 }
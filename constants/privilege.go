@@ -0,0 +1,18 @@
+package constants
+
+// AlbumPrivilege defines levels of `user_album.privilege`. Owner is never stored
+// there, it comes from `albums.owner`
+var AlbumPrivilege = map[string]int{
+	"viewer":      0,
+	"contributor": 1,
+	"coOwner":     2,
+	"owner":       3,
+}
+
+// FilePrivilege defines levels of `user_file.privilege`. Owner is never stored
+// there, it comes from `files.owner`
+var FilePrivilege = map[string]int{
+	"viewer": 0,
+	"editor": 1,
+	"owner":  2,
+}
@@ -0,0 +1,12 @@
+package constants
+
+// Scope defines permissions of API tokens. Sessions have all of them,
+// `account` is never granted to a token so tokens can't manage other tokens
+var Scope = map[string]string{
+	"readFiles":    "files:read",
+	"upload":       "files:upload",
+	"manageAlbums": "albums:manage",
+	"delete":       "files:delete",
+	"share":        "files:share",
+	"account":      "account",
+}
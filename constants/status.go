@@ -0,0 +1,25 @@
+package constants
+
+// FileStatus defines states of a file. Uploaded files are processing until
+// their renditions and metadata are ready
+var FileStatus = map[string]string{
+	"processing": "PROCESSING",
+	"ready":      "READY",
+	"failed":     "FAILED",
+}
+
+// JobStatus defines states of a processing job
+var JobStatus = map[string]string{
+	"queued":  "QUEUED",
+	"running": "RUNNING",
+	"done":    "DONE",
+	"failed":  "FAILED",
+}
+
+// UploadStatus defines outcomes of an uploaded file
+var UploadStatus = map[string]string{
+	"created":   "created",
+	"duplicate": "duplicate",
+	"rejected":  "rejected",
+	"failed":    "failed",
+}
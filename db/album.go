@@ -23,54 +23,54 @@ var selectAlbum = `
 		albums.updated_at,
 		albums.created_at,
 
-		files.id,
-		files.owner,
-		files.name,
-		files.hash,
-		files.size,
-		files.extension,
-		files.mime,
-		files.latitude,
-		files.longitude,
-		files.orientation,
-		files.model,
-		files.camera,
-		files.iso,
-		files.focal_length,
-		files.exposure_time,
-		files.f_number,
-		files.height,
-		files.width,
-		files.date
+		` + selectFileColumns("files") + `
 	FROM albums
-	LEFT JOIN files ON albums.cover = files.id
+	LEFT JOIN files ON albums.cover = files.id AND files.trashed_at IS NULL
 	WHERE albums.owner = $1
 `
 
-// hasAlbumAccess checks if an user is an owner of the album or
-// the album is shared with him
-func hasAlbumAccess(userID int, albumID string, db *sql.DB) bool {
-	var count int
+// getAlbumPrivilege returns a privilege of the user to the album. The owner gets
+// `owner` privilege, members what is stored in `user_album`
+func getAlbumPrivilege(userID int, albumID string, db *sql.DB) (int, bool) {
+	var privilege int
 	rawQuery := `
 		SELECT
-			count(*)
+			CASE WHEN albums.owner = $1 THEN $3 ELSE user_album.privilege END
 		FROM
 			albums
-			LEFT JOIN user_album ON user_album.album = albums.id
-		WHERE 
-			(albums.owner = $1 AND albums.id = $2)
-			OR (user_album.album = $2 AND user_album.user = $1);
+			LEFT JOIN user_album ON user_album.album = albums.id AND user_album.user = $1
+		WHERE
+			albums.id = $2
+			AND (albums.owner = $1 OR user_album.user = $1)
+		ORDER BY 1 DESC
+		LIMIT 1;
 	`
 
-	row := db.QueryRow(rawQuery, userID, albumID)
-	err := row.Scan(&count)
+	row := db.QueryRow(rawQuery, userID, albumID, constants.AlbumPrivilege["owner"])
+	err := row.Scan(&privilege)
 	if err != nil {
-		log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID)
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Send()
+		}
 
-		return false
+		return 0, false
 	}
 
-	return count > 0
+	return privilege, true
+}
+
+// hasAlbumPrivilege checks if an user is an owner of the album or
+// the album is shared with him with at least the given privilege
+func hasAlbumPrivilege(userID int, albumID string, privilege int, db *sql.DB) bool {
+	userPrivilege, ok := getAlbumPrivilege(userID, albumID, db)
+
+	return ok && userPrivilege >= privilege
+}
+
+// hasAlbumAccess checks if an user is an owner of the album or
+// the album is shared with him
+func hasAlbumAccess(userID int, albumID string, db *sql.DB) bool {
+	return hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["viewer"], db)
 }
 
 func isFileInAlbum(fileID int, albumID string, db *sql.DB) bool {
@@ -103,33 +103,20 @@ func GetAlbumContent(userID int, albumID string, db *sql.DB) ([]model.File, erro
 		return []model.File{}, errors.New(constants.STRINGS["noAccessToAlbum"])
 	}
 
-	// user has access to the album so take all files from the album
+	return getAlbumFiles(albumID, db)
+}
+
+// getAlbumFiles returns all files from the album without checking access. Trashed files are skipped
+func getAlbumFiles(albumID string, db *sql.DB) ([]model.File, error) {
 	rawQuery := `
 		SELECT
-			files.id,
-			files.owner,
-			files.name,
-			files.hash,
-			files.size,
-			files.extension,
-			files.mime,
-			files.latitude,
-			files.longitude,
-			files.orientation,
-			files.model,
-			files.camera,
-			files.iso,
-			files.focal_length,
-			files.exposure_time,
-			files.f_number,
-			files.height,
-			files.width,
-			files.date
+			` + selectFileColumns("files") + `
 		FROM
 			files
 			LEFT JOIN album_file ON files.id = album_file.file
 		WHERE
-			album_file."album" = $1;
+			album_file."album" = $1
+			AND files.trashed_at IS NULL;
 	`
 
 	rows, _ := db.Query(rawQuery, albumID)
@@ -168,14 +155,15 @@ func CreateAlbum(userID int, name string, db *sql.DB) (model.Album, error) {
 }
 
 // AddFilesToAlbum adds file(s) to the album where user is an owner or the album is shared with him
+// at least as a contributor. Files have to be owned by the user or shared with him as an editor
 func AddFilesToAlbum(albumID string, userID int, files []int, db *sql.DB) int {
-	hasAccess := hasAlbumAccess(userID, albumID, db)
+	hasAccess := hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["contributor"], db)
 	if !hasAccess {
 		return http.StatusForbidden
 	}
 
 	for _, fileID := range files {
-		if !hasFileAccess(userID, fileID, db) {
+		if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["editor"], db) {
 			log.Warn().
 				Caller().
 				Int("user", userID).
@@ -205,10 +193,10 @@ func AddFilesToAlbum(albumID string, userID int, files []int, db *sql.DB) int {
 	return http.StatusOK
 }
 
-// SetAlbumCover sets an albums' cover only when a user have access to the album
+// SetAlbumCover sets an albums' cover only when a user is an owner or a co-owner of the album
 // and a file is already in the album
 func SetAlbumCover(albumID string, userID, fileID int, db *sql.DB) (int, model.File) {
-	hasAccess := hasAlbumAccess(userID, albumID, db)
+	hasAccess := hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db)
 	if !hasAccess {
 		return http.StatusForbidden, model.File{}
 	}
@@ -238,16 +226,32 @@ func SetAlbumCover(albumID string, userID, fileID int, db *sql.DB) (int, model.F
 	return http.StatusBadRequest, model.File{}
 }
 
-// RemoveFromAlbum removes a file from an album if a user has access to the album.
-// Doesn't care whether the user is an owner of the file / album.
+// RemoveFromAlbum removes a file from an album if a user is an owner or a co-owner of the album.
+// Contributors can remove only files they added. Doesn't care whether the user is an owner of the file.
 func RemoveFromAlbum(albumID string, userID, fileID int, db *sql.DB) int {
-	hasAccess := hasAlbumAccess(userID, albumID, db)
-	if !hasAccess {
+	privilege, hasAccess := getAlbumPrivilege(userID, albumID, db)
+	if !hasAccess || privilege < constants.AlbumPrivilege["contributor"] {
 		return http.StatusForbidden
 	}
 
-	rawQuery := `DELETE FROM "album_file" WHERE file = $1;`
-	db.Exec(rawQuery, fileID)
+	rawQuery := `DELETE FROM "album_file" WHERE file = $1 AND album = $2`
+	if privilege < constants.AlbumPrivilege["coOwner"] {
+		rawQuery += " AND added_by = $3"
+		result, err := db.Exec(rawQuery, fileID, albumID, userID)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Str("album", albumID).Send()
+
+			return http.StatusInternalServerError
+		}
+
+		if rowsNo, _ := result.RowsAffected(); rowsNo == 0 && isFileInAlbum(fileID, albumID, db) {
+			return http.StatusForbidden
+		}
+
+		return http.StatusOK
+	}
+
+	db.Exec(rawQuery, fileID, albumID)
 
 	return http.StatusOK
 }
@@ -255,7 +259,7 @@ func RemoveFromAlbum(albumID string, userID, fileID int, db *sql.DB) int {
 // DeleteAlbum deletes an album by a user who is an owner. DB takes care of
 // removing all related data from `user_album` and `album_file` tables
 func DeleteAlbum(albumID string, userID int, db *sql.DB) error {
-	hasAccess := hasAlbumAccess(userID, albumID, db)
+	hasAccess := hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["owner"], db)
 	if !hasAccess {
 		return errors.New(constants.STRINGS["noAccessToAlbum"])
 	}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	constants "photos/constants"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
+)
+
+type albumLinkAccess struct {
+	album         int
+	password      sql.NullString
+	allowDownload bool
+}
+
+// CreateAlbumLink creates a public link to the album. Only an owner and co-owners can do it.
+// Empty password means everyone knowing the link can open it
+func CreateAlbumLink(
+	albumID string,
+	userID int,
+	password string,
+	allowDownload bool,
+	expiresAt null.Time,
+	db *sql.DB,
+) (int, model.AlbumLink, error) {
+	if !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden, model.AlbumLink{}, errors.New(constants.STRINGS["noAccessToAlbum"])
+	}
+
+	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		return http.StatusBadRequest, model.AlbumLink{}, errors.New(constants.STRINGS["linkExpiresInPast"])
+	}
+
+	var passwordHash sql.NullString
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't hash a link password")
+
+			return http.StatusInternalServerError, model.AlbumLink{}, err
+		}
+
+		passwordHash = sql.NullString{String: string(hash), Valid: true}
+	}
+
+	token, hash, err := createToken()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate a link token")
+
+		return http.StatusInternalServerError, model.AlbumLink{}, err
+	}
+
+	link := model.AlbumLink{
+		Token:         token,
+		HasPassword:   passwordHash.Valid,
+		AllowDownload: allowDownload,
+		ExpiresAt:     expiresAt,
+	}
+	query := `
+		INSERT INTO album_links(album, token, password, allow_download, expires_at, created_by)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING id, album, created_at
+	`
+	row := db.QueryRow(query, albumID, hash, passwordHash, allowDownload, expiresAt, userID)
+	err = row.Scan(&link.ID, &link.Album, &link.CreatedAt)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Msg("Can't create a link")
+
+		return http.StatusInternalServerError, model.AlbumLink{}, err
+	}
+
+	return http.StatusCreated, link, nil
+}
+
+// GetAlbumLinks returns links of the album without their tokens
+func GetAlbumLinks(albumID string, userID int, db *sql.DB) (int, []model.AlbumLink) {
+	links := []model.AlbumLink{}
+	if !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden, links
+	}
+
+	query := `
+		SELECT id, album, password IS NOT NULL, allow_download, expires_at, created_at
+		FROM album_links
+		WHERE album = $1
+		ORDER BY created_at
+	`
+	rows, err := db.Query(query, albumID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Msg("Can't fetch links")
+
+		return http.StatusInternalServerError, links
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link := model.AlbumLink{}
+		err := rows.Scan(
+			&link.ID,
+			&link.Album,
+			&link.HasPassword,
+			&link.AllowDownload,
+			&link.ExpiresAt,
+			&link.CreatedAt,
+		)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Msg("Can't parse links")
+
+			return http.StatusInternalServerError, links
+		}
+
+		links = append(links, link)
+	}
+
+	return http.StatusOK, links
+}
+
+// DeleteAlbumLink revokes the link. Only an owner and co-owners can do it
+func DeleteAlbumLink(albumID string, userID, linkID int, db *sql.DB) int {
+	if !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden
+	}
+
+	query := `DELETE FROM album_links WHERE id = $1 AND album = $2`
+	result, err := db.Exec(query, linkID, albumID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("link", linkID).Msg("Can't delete a link")
+
+		return http.StatusInternalServerError
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound
+	}
+
+	return http.StatusOK
+}
+
+// openAlbumLink checks that the link exists, hasn't expired and the password matches
+func openAlbumLink(token, password string, db *sql.DB) (int, albumLinkAccess, error) {
+	access := albumLinkAccess{}
+	query := `
+		SELECT album, password, allow_download
+		FROM album_links
+		WHERE token = $1 AND (expires_at IS NULL OR expires_at > now())
+	`
+	row := db.QueryRow(query, hashToken(token))
+	err := row.Scan(&access.album, &access.password, &access.allowDownload)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, access, errors.New(constants.STRINGS["linkNotFound"])
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Msg("Can't fetch a link")
+
+		return http.StatusInternalServerError, access, err
+	}
+
+	if access.password.Valid &&
+		bcrypt.CompareHashAndPassword([]byte(access.password.String), []byte(password)) != nil {
+		return http.StatusUnauthorized, access, errors.New(constants.STRINGS["linkPasswordInvalid"])
+	}
+
+	return http.StatusOK, access, nil
+}
+
+// GetLinkContent returns files of the album behind the link. Hashes are removed
+// so they can't be used to reach the files another way
+func GetLinkContent(token, password string, db *sql.DB) (int, []model.File, error) {
+	status, access, err := openAlbumLink(token, password, db)
+	if err != nil {
+		return status, []model.File{}, err
+	}
+
+	files, err := getAlbumFiles(fmt.Sprintf("%d", access.album), db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("album", access.album).Msg("Can't fetch files of a link")
+
+		return http.StatusInternalServerError, []model.File{}, err
+	}
+
+	for i := range files {
+		files[i].Hash = null.String{}
+	}
+
+	return http.StatusOK, files, nil
+}
+
+// GetLinkFile returns a file from the album behind the link. Originals are available
+// only when the link allows downloading
+func GetLinkFile(token, password string, fileID int, original bool, db *sql.DB) (int, model.File, error) {
+	status, access, err := openAlbumLink(token, password, db)
+	if err != nil {
+		return status, model.File{}, err
+	}
+
+	if original && !access.allowDownload {
+		return http.StatusForbidden, model.File{}, nil
+	}
+
+	query := selectFile + `
+		WHERE
+			id = $1
+			AND trashed_at IS NULL
+			AND id IN (SELECT file FROM album_file WHERE album = $2)
+	`
+	file, err := fileScanner(db.QueryRow(query, fileID, access.album))
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, model.File{}, nil
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("file", fileID).Msg("Can't fetch a file of a link")
+
+		return http.StatusInternalServerError, model.File{}, err
+	}
+
+	return http.StatusOK, file, nil
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCreateAlbumLink(t *testing.T) {
+	userID := 20
+	albumID := "1"
+
+	status, _, _ := CreateAlbumLink(albumID, 10, "", false, null.Time{}, db)
+	if status != http.StatusForbidden {
+		t.Errorf("CreateAlbumLink - status: %d, expected %d - viewer creates a link", status, http.StatusForbidden)
+	}
+
+	expired := null.TimeFrom(time.Now().Add(-time.Hour))
+	status, _, _ = CreateAlbumLink(albumID, userID, "", false, expired, db)
+	if status != http.StatusBadRequest {
+		t.Errorf("CreateAlbumLink - status: %d, expected %d - expiration in the past", status, http.StatusBadRequest)
+	}
+
+	status, link, err := CreateAlbumLink(albumID, userID, "secret", false, null.Time{}, db)
+	if status != http.StatusCreated || err != nil || link.Token == "" || !link.HasPassword {
+		t.Errorf("CreateAlbumLink - status: %d, expected %d - error: %s", status, http.StatusCreated, err)
+	}
+
+	status, files, _ := GetLinkContent(link.Token, "wrong", db)
+	if status != http.StatusUnauthorized || len(files) != 0 {
+		t.Errorf("GetLinkContent - status: %d, expected %d - wrong password", status, http.StatusUnauthorized)
+	}
+
+	status, files, err = GetLinkContent(link.Token, "secret", db)
+	if status != http.StatusOK || err != nil || len(files) == 0 || files[0].Hash.Valid {
+		t.Errorf("GetLinkContent - status: %d, expected %d - error: %s", status, http.StatusOK, err)
+	}
+
+	fileID := int(files[0].ID.ValueOrZero())
+	status, _, _ = GetLinkFile(link.Token, "secret", fileID, true, db)
+	if status != http.StatusForbidden {
+		t.Errorf("GetLinkFile - status: %d, expected %d - download not allowed", status, http.StatusForbidden)
+	}
+
+	status, file, _ := GetLinkFile(link.Token, "secret", fileID, false, db)
+	if status != http.StatusOK || file.ID.ValueOrZero() != int64(fileID) {
+		t.Errorf("GetLinkFile - status: %d, expected %d - resized file", status, http.StatusOK)
+	}
+}
+
+func TestDeleteAlbumLink(t *testing.T) {
+	userID := 20
+	albumID := "1"
+	_, link, _ := CreateAlbumLink(albumID, userID, "", true, null.Time{}, db)
+
+	_, links := GetAlbumLinks(albumID, userID, db)
+	if len(links) == 0 || links[len(links)-1].Token != "" {
+		t.Errorf("GetAlbumLinks - tokens must not be returned")
+	}
+
+	status := DeleteAlbumLink(albumID, userID, link.ID, db)
+	linkStatus, _, _ := GetLinkContent(link.Token, "", db)
+	if status != http.StatusOK || linkStatus != http.StatusNotFound {
+		t.Errorf("DeleteAlbumLink - status: %d, link status: %d - removed link", status, linkStatus)
+	}
+}
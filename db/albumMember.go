@@ -0,0 +1,168 @@
+package db
+
+import (
+	"database/sql"
+	"net/http"
+
+	constants "photos/constants"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+func isAlbumMember(memberID int, albumID string, db *sql.DB) bool {
+	var count int
+	rawQuery := `SELECT count(id) FROM user_album WHERE "user" = $1 AND album = $2`
+
+	row := db.QueryRow(rawQuery, memberID, albumID)
+	err := row.Scan(&count)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", memberID).Str("album", albumID).Send()
+
+		return false
+	}
+
+	return count > 0
+}
+
+func isAlbumOwner(userID int, albumID string, db *sql.DB) bool {
+	var count int
+	rawQuery := `SELECT count(id) FROM albums WHERE owner = $1 AND id = $2`
+
+	row := db.QueryRow(rawQuery, userID, albumID)
+	err := row.Scan(&count)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Send()
+
+		return false
+	}
+
+	return count > 0
+}
+
+// GetAlbumMembers returns users with whom the album is shared. Every member can see them
+func GetAlbumMembers(albumID string, userID int, db *sql.DB) (int, []model.Member) {
+	members := []model.Member{}
+	if !hasAlbumAccess(userID, albumID, db) {
+		return http.StatusForbidden, members
+	}
+
+	rawQuery := `
+		SELECT
+			users.id,
+			users.first_name,
+			users.last_name,
+			users.email,
+			max(user_album.privilege)
+		FROM
+			user_album
+			JOIN users ON users.id = user_album.user
+		WHERE
+			user_album.album = $1
+		GROUP BY users.id
+		ORDER BY users.id;
+	`
+
+	rows, err := db.Query(rawQuery, albumID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Msg("Can't fetch members")
+
+		return http.StatusInternalServerError, members
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var privilege int
+		member := model.Member{}
+		err := rows.Scan(&member.User, &member.FirstName, &member.LastName, &member.Email, &privilege)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Str("album", albumID).Msg("Can't parse members")
+
+			return http.StatusInternalServerError, members
+		}
+
+		member.Privilege = getPrivilegeName(constants.AlbumPrivilege, privilege)
+		members = append(members, member)
+	}
+
+	return http.StatusOK, members
+}
+
+// AddAlbumMember shares the album with another user. Only an owner and co-owners can
+// do it. When the album is already shared with the user, the privilege is changed
+func AddAlbumMember(albumID string, userID, memberID int, privilegeName string, db *sql.DB) (int, error) {
+	privilege, err := parsePrivilege(constants.AlbumPrivilege, privilegeName)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden, nil
+	}
+
+	if _, err := GetUser(memberID, db); err != nil || isAlbumOwner(memberID, albumID, db) {
+		return http.StatusBadRequest, nil
+	}
+
+	if isAlbumMember(memberID, albumID, db) {
+		return ChangeAlbumMember(albumID, userID, memberID, privilegeName, db)
+	}
+
+	rawQuery := `INSERT INTO user_album("user", album, privilege) VALUES($1, $2, $3)`
+	_, err = db.Exec(rawQuery, memberID, albumID, privilege)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Str("album", albumID).Send()
+
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusCreated, nil
+}
+
+// ChangeAlbumMember changes a privilege of the member. Only an owner and co-owners can do it
+func ChangeAlbumMember(albumID string, userID, memberID int, privilegeName string, db *sql.DB) (int, error) {
+	privilege, err := parsePrivilege(constants.AlbumPrivilege, privilegeName)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden, nil
+	}
+
+	rawQuery := `UPDATE user_album SET privilege = $1, updated_at = now() WHERE "user" = $2 AND album = $3`
+	result, err := db.Exec(rawQuery, privilege, memberID, albumID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Str("album", albumID).Send()
+
+		return http.StatusInternalServerError, err
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound, nil
+	}
+
+	return http.StatusOK, nil
+}
+
+// RemoveAlbumMember revokes the share. Owner and co-owners can remove anyone,
+// other members can only leave the album
+func RemoveAlbumMember(albumID string, userID, memberID int, db *sql.DB) int {
+	if userID != memberID && !hasAlbumPrivilege(userID, albumID, constants.AlbumPrivilege["coOwner"], db) {
+		return http.StatusForbidden
+	}
+
+	rawQuery := `DELETE FROM user_album WHERE "user" = $1 AND album = $2`
+	result, err := db.Exec(rawQuery, memberID, albumID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Str("album", albumID).Send()
+
+		return http.StatusInternalServerError
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound
+	}
+
+	return http.StatusOK
+}
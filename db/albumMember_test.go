@@ -0,0 +1,72 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddAlbumMember(t *testing.T) {
+	ownerID := 9
+	memberID := 11
+	albumID := "88"
+
+	status, err := AddAlbumMember(albumID, ownerID, memberID, "viewer", db)
+	_, members := GetAlbumMembers(albumID, ownerID, db)
+	privilege := ""
+	for _, member := range members {
+		if member.User == memberID {
+			privilege = member.Privilege
+		}
+	}
+	if status != http.StatusCreated || err != nil || len(members) != 3 || privilege != "viewer" {
+		t.Errorf("AddAlbumMember - status: %d, expected %d - owner shares the album", status, http.StatusCreated)
+	}
+
+	status, _ = AddAlbumMember(albumID, ownerID, memberID, "owner", db)
+	if status != http.StatusBadRequest {
+		t.Errorf("AddAlbumMember - status: %d, expected %d - owner can't be granted", status, http.StatusBadRequest)
+	}
+
+	status, _ = AddAlbumMember(albumID, memberID, 4, "viewer", db)
+	if status != http.StatusForbidden {
+		t.Errorf("AddAlbumMember - status: %d, expected %d - viewer shares the album", status, http.StatusForbidden)
+	}
+
+	status = AddFilesToAlbum(albumID, memberID, []int{}, db)
+	if status != http.StatusForbidden {
+		t.Errorf("AddFilesToAlbum - status: %d, expected %d - viewer adds files", status, http.StatusForbidden)
+	}
+
+	status, _ = ChangeAlbumMember(albumID, ownerID, memberID, "contributor", db)
+	addStatus := AddFilesToAlbum(albumID, memberID, []int{}, db)
+	if status != http.StatusOK || addStatus != http.StatusOK {
+		t.Errorf("ChangeAlbumMember - status: %d, expected %d - contributor adds files", addStatus, http.StatusOK)
+	}
+
+	status, _ = SetAlbumCover(albumID, memberID, 4, db)
+	if status != http.StatusForbidden {
+		t.Errorf("SetAlbumCover - status: %d, expected %d - contributor sets cover", status, http.StatusForbidden)
+	}
+}
+
+func TestRemoveAlbumMember(t *testing.T) {
+	ownerID := 4
+	memberID := 5
+	albumID := "44"
+
+	AddAlbumMember(albumID, ownerID, memberID, "coOwner", db)
+	status := RemoveAlbumMember(albumID, memberID, 7, db)
+	if status != http.StatusNotFound {
+		t.Errorf("RemoveAlbumMember - status: %d, expected %d - not a member", status, http.StatusNotFound)
+	}
+
+	err := DeleteAlbum(albumID, memberID, db)
+	if err == nil {
+		t.Errorf("DeleteAlbum - co-owner can't delete the album")
+	}
+
+	status = RemoveAlbumMember(albumID, memberID, memberID, db)
+	if status != http.StatusOK || hasAlbumAccess(memberID, albumID, db) {
+		t.Errorf("RemoveAlbumMember - status: %d, expected %d - member leaves", status, http.StatusOK)
+	}
+}
@@ -3,18 +3,21 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"testing"
 
 	constants "photos/constants"
 	dev "photos/dev"
+	"photos/storage"
 
 	_ "github.com/lib/pq"
 	"github.com/subosito/gotenv"
 )
 
 var db *sql.DB
+var store storage.Storage
 
 func TestGetAlbumContent(t *testing.T) {
 	userID := 10
@@ -237,5 +240,16 @@ func TestMain(m *testing.M) {
 	db = database
 	dev.ResetDatabase(database)
 
-	os.Exit(m.Run())
+	dir, err := ioutil.TempDir("", "photos")
+	if err != nil {
+		panic(err)
+	}
+	store, err = storage.NewLocal(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
 }
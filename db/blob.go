@@ -0,0 +1,170 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"photos/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// contentHash names a stored blob by its content, so the same bytes are kept only once
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// readerHash is contentHash of the content read from its start
+func readerHash(content io.ReadSeeker) (string, error) {
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, content); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func blobExists(hash string, db *sql.DB) bool {
+	var count int
+	rawQuery := `SELECT count(hash) FROM blobs WHERE hash = $1`
+
+	err := db.QueryRow(rawQuery, hash).Scan(&count)
+	if err != nil {
+		log.Error().Err(err).Caller().Str("hash", hash).Send()
+
+		return false
+	}
+
+	return count > 0
+}
+
+// lockBlob tells whether the blob is stored and keeps it locked until the transaction ends.
+// The last reference can't be released in the meantime, so the blob isn't removed from the
+// storage before the file referencing it is committed
+func lockBlob(hash string, tx *sql.Tx) (bool, error) {
+	var refs int
+	rawQuery := `SELECT refs FROM blobs WHERE hash = $1 FOR UPDATE`
+
+	err := tx.QueryRow(rawQuery, hash).Scan(&refs)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// retainBlob increases the number of files referencing the blob
+func retainBlob(hash string, size int64, tx *sql.Tx) error {
+	rawQuery := `
+		INSERT INTO blobs(hash, refs, size) VALUES($1, 1, $2)
+		ON CONFLICT (hash) DO UPDATE SET refs = blobs.refs + 1
+	`
+	_, err := tx.Exec(rawQuery, hash, size)
+
+	return err
+}
+
+// releaseBlob decreases the number of files referencing the blob. It returns true
+// when the last reference is gone and the blob can be removed from the storage
+func releaseBlob(hash string, tx *sql.Tx) (bool, error) {
+	var refs int
+	rawQuery := `UPDATE blobs SET refs = refs - 1 WHERE hash = $1 RETURNING refs`
+
+	err := tx.QueryRow(rawQuery, hash).Scan(&refs)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if refs > 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`DELETE FROM blobs WHERE hash = $1`, hash)
+
+	return err == nil, err
+}
+
+// getUserFileByHash returns id of the user's file with the same content
+func getUserFileByHash(hash string, userID int, db *sql.DB) (int, bool) {
+	var fileID int
+	rawQuery := `SELECT id FROM files WHERE owner = $1 AND hash = $2 ORDER BY id LIMIT 1`
+
+	err := db.QueryRow(rawQuery, userID, hash).Scan(&fileID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Caller().Int("user", userID).Str("hash", hash).Send()
+		}
+
+		return 0, false
+	}
+
+	return fileID, true
+}
+
+// removeBlob removes the original and all its variants from the storage. They share the hash prefix
+func removeBlob(hash string, store storage.Storage) error {
+	objects, err := store.List(hash)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if err := store.Delete(object.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindOrphanBlobs returns stored objects which don't belong to any file: originals without
+// a blob and renditions which no file references, e.g. of a previous rotation. Objects
+// modified within the grace period are skipped, their upload may still be in progress
+func FindOrphanBlobs(store storage.Storage, grace time.Duration, db *sql.DB) ([]storage.Info, error) {
+	orphans := []storage.Info{}
+	keys := map[string]bool{}
+
+	rows, err := db.Query(`SELECT hash FROM blobs UNION ALL SELECT key FROM renditions`)
+	if err != nil {
+		return orphans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return orphans, err
+		}
+
+		keys[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return orphans, err
+	}
+
+	objects, err := store.List("")
+	if err != nil {
+		return orphans, err
+	}
+
+	threshold := time.Now().Add(-grace)
+	for _, object := range objects {
+		if !keys[object.Key] && object.ModTime.Before(threshold) {
+			orphans = append(orphans, object)
+		}
+	}
+
+	return orphans, nil
+}
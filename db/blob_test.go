@@ -0,0 +1,82 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleaseBlob(t *testing.T) {
+	hash := contentHash([]byte("shared content"))
+
+	tx, _ := db.Begin()
+	retainBlob(hash, 14, tx)
+	retainBlob(hash, 14, tx)
+	tx.Commit()
+
+	tx, _ = db.Begin()
+	last, err := releaseBlob(hash, tx)
+	tx.Commit()
+	if last || err != nil || !blobExists(hash, db) {
+		t.Errorf("releaseBlob - blob referenced by another file must stay - error: %s", err)
+	}
+
+	tx, _ = db.Begin()
+	last, err = releaseBlob(hash, tx)
+	tx.Commit()
+	if !last || err != nil || blobExists(hash, db) {
+		t.Errorf("releaseBlob - last reference should remove the blob - error: %s", err)
+	}
+}
+
+func TestGetUserFileByHash(t *testing.T) {
+	file, _ := getFileByID(5, db)
+
+	fileID, ok := getUserFileByHash(file.Hash.String, int(file.Owner.Int64), db)
+	if !ok || fileID != 5 {
+		t.Errorf("getUserFileByHash - %d, expected %d - owner's file", fileID, 5)
+	}
+
+	_, ok = getUserFileByHash(file.Hash.String, int(file.Owner.Int64)+1, db)
+	if ok {
+		t.Errorf("getUserFileByHash - duplicates are checked per user")
+	}
+}
+
+func TestRemoveBlob(t *testing.T) {
+	hash := contentHash([]byte("removed content"))
+	store.Put(hash, strings.NewReader("original"), 8, "image/jpeg")
+	store.Put(hash+"_mobile", strings.NewReader("mobile"), 6, "image/jpeg")
+
+	err := removeBlob(hash, store)
+	objects, _ := store.List(hash)
+	if err != nil || len(objects) != 0 {
+		t.Errorf("removeBlob - %d objects left, expected %d - error: %s", len(objects), 0, err)
+	}
+}
+
+func TestFindOrphanBlobs(t *testing.T) {
+	file, _ := getFileByID(7, db)
+	orphan := contentHash([]byte("orphan content"))
+	store.Put(file.Hash.String, strings.NewReader("original"), 8, "image/jpeg")
+	store.Put(orphan+"_mobile", strings.NewReader("mobile"), 6, "image/jpeg")
+	// A rendition of a previous rotation of a stored blob
+	store.Put(file.Hash.String+"_r90_mobile.jpg", strings.NewReader("mobile"), 6, "image/jpeg")
+
+	orphans, err := FindOrphanBlobs(store, time.Hour, db)
+	if err != nil || len(orphans) != 0 {
+		t.Errorf("FindOrphanBlobs - %d, expected %d - fresh objects are skipped", len(orphans), 0)
+	}
+
+	orphans, err = FindOrphanBlobs(store, 0, db)
+	found := map[string]bool{}
+	for _, o := range orphans {
+		found[o.Key] = true
+	}
+	if err != nil || len(orphans) != 2 || !found[orphan+"_mobile"] || !found[file.Hash.String+"_r90_mobile.jpg"] {
+		t.Errorf("FindOrphanBlobs - %d, expected %d - error: %s", len(orphans), 2, err)
+	}
+
+	store.Delete(orphan + "_mobile")
+	store.Delete(file.Hash.String + "_r90_mobile.jpg")
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"photos/constants"
+	"photos/image"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// editsMaxCount limits the edit stack, renditions are rendered from the original through all of it
+const editsMaxCount = 50
+
+// encodeEdits converts the edit stack to JSON stored in `files.edits`
+func encodeEdits(edits []model.Edit) string {
+	if len(edits) == 0 {
+		return "[]"
+	}
+
+	encoded, _ := json.Marshal(edits)
+
+	return string(encoded)
+}
+
+// getEditableFile returns the image if the user can edit it: owns it or it's shared
+// with him as an editor
+func getEditableFile(fileID, userID int, db *sql.DB) (int, model.File, error) {
+	if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["editor"], db) {
+		return http.StatusForbidden, model.File{}, nil
+	}
+
+	file, err := getFileByID(fileID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch a file")
+
+		return http.StatusInternalServerError, file, err
+	}
+	if file.Type.String == constants.FileType["video"] {
+		return http.StatusBadRequest, file, errors.New(constants.STRINGS["videoNotEditable"])
+	}
+
+	return http.StatusOK, file, nil
+}
+
+// renderingChange changes the rotation and the edit stack of a file. It returns the new
+// ones or a status and an error why they can't be changed
+type renderingChange func(rotation int64, edits []model.Edit) (int64, []model.Edit, int, error)
+
+// changeRendering applies the change to the rotation and the edit stack of the image
+// locked for the transaction, so concurrent changes don't overwrite each other. The
+// original is kept, the file is processing again until its renditions are rendered
+func changeRendering(fileID, userID int, change renderingChange, db *sql.DB) (int, model.File, error) {
+	status, file, err := getEditableFile(fileID, userID, db)
+	if status != http.StatusOK {
+		return status, file, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't start a transaction")
+
+		return http.StatusInternalServerError, file, err
+	}
+	defer tx.Rollback()
+
+	var rotation int64
+	var edits []model.Edit
+	rawQuery := `SELECT rotation, edits FROM files WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(rawQuery, fileID).Scan(&rotation, jsonColumn{&edits}); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch a file")
+
+		return http.StatusInternalServerError, file, err
+	}
+	file.Rotation, file.Edits = null.IntFrom(rotation), edits
+
+	newRotation, newEdits, status, err := change(rotation, edits)
+	if status != http.StatusOK {
+		return status, file, err
+	}
+	if newRotation == rotation && encodeEdits(newEdits) == encodeEdits(edits) {
+		return http.StatusOK, file, nil
+	}
+
+	rawQuery = `UPDATE files SET rotation = $1, edits = $2::jsonb, status = $3, updated_at = now() WHERE id = $4`
+	_, err = tx.Exec(rawQuery, newRotation, encodeEdits(newEdits), constants.FileStatus["processing"], fileID)
+	if err == nil {
+		err = enqueueJob(int64(fileID), tx)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't edit a file")
+
+		return http.StatusInternalServerError, file, err
+	}
+
+	file.Rotation = null.IntFrom(newRotation)
+	file.Edits = newEdits
+	file.Status = null.StringFrom(constants.FileStatus["processing"])
+
+	return http.StatusAccepted, file, nil
+}
+
+// RotateFile turns the image clockwise by the degrees on top of its current rotation. The
+// rotation is applied before the edit stack. Editors can rotate
+func RotateFile(fileID, userID int, degrees int64, db *sql.DB) (int, model.File, error) {
+	if degrees%90 != 0 {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["rotationInvalid"])
+	}
+
+	return changeRendering(fileID, userID, func(rotation int64, edits []model.Edit) (int64, []model.Edit, int, error) {
+		return ((rotation+degrees)%360 + 360) % 360, edits, http.StatusOK, nil
+	}, db)
+}
+
+// AddEdit pushes the edit on the edit stack of the image. Editors can edit
+func AddEdit(fileID, userID int, edit model.Edit, db *sql.DB) (int, model.File, error) {
+	if !image.ValidEdit(edit) {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["editInvalid"])
+	}
+
+	return changeRendering(fileID, userID, func(rotation int64, edits []model.Edit) (int64, []model.Edit, int, error) {
+		if len(edits) >= editsMaxCount {
+			return rotation, edits, http.StatusBadRequest, fmt.Errorf(constants.STRINGS["editsTooMany"], editsMaxCount)
+		}
+
+		return rotation, append(edits, edit), http.StatusOK, nil
+	}, db)
+}
+
+// UndoEdit removes the last edit from the edit stack of the image
+func UndoEdit(fileID, userID int, db *sql.DB) (int, model.File, error) {
+	return changeRendering(fileID, userID, func(rotation int64, edits []model.Edit) (int64, []model.Edit, int, error) {
+		if len(edits) == 0 {
+			return rotation, edits, http.StatusBadRequest, errors.New(constants.STRINGS["nothingToUndo"])
+		}
+
+		return rotation, edits[:len(edits)-1], http.StatusOK, nil
+	}, db)
+}
+
+// RevertFile drops the rotation and all edits, the image looks like its original again
+func RevertFile(fileID, userID int, db *sql.DB) (int, model.File, error) {
+	return changeRendering(fileID, userID, func(int64, []model.Edit) (int64, []model.Edit, int, error) {
+		return 0, nil, http.StatusOK, nil
+	}, db)
+}
+
+// CopyFile saves the image with its rotation and edits as a new file of the user. The copy
+// shares the original, it's edited independently of the source and linked to it as its
+// source. Everyone who can see the image can copy it
+func CopyFile(fileID, userID int, db *sql.DB) (int, model.File, error) {
+	status, file := GetViewableFile(fileID, userID, db)
+	if status != http.StatusOK {
+		return status, file, nil
+	}
+	if file.TrashedAt.Valid || file.Type.String == constants.FileType["video"] {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["sourceFileInvalid"])
+	}
+
+	rawQuery := `
+		INSERT INTO files (
+			type, owner, name, hash, size, extension,
+			mime, latitude, longitude, orientation,
+			model, camera, iso, focal_length,
+			exposure_time, f_number, height,
+			width, date, lens_make, lens_model,
+			flash, white_balance, metering_mode,
+			exposure_bias, software, copyright,
+			title, caption, keywords, rating,
+			tags, place, exif, rotation, edits, status
+		)
+		SELECT
+			type, $2, name, hash, size, extension,
+			mime, latitude, longitude, orientation,
+			model, camera, iso, focal_length,
+			exposure_time, f_number, height,
+			width, date, lens_make, lens_model,
+			flash, white_balance, metering_mode,
+			exposure_bias, software, copyright,
+			title, caption, keywords, rating,
+			tags, place, exif, rotation, edits, $3
+		FROM files
+		WHERE id = $1
+		RETURNING id
+	`
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't start a transaction")
+
+		return http.StatusInternalServerError, model.File{}, err
+	}
+	defer tx.Rollback()
+
+	var copyID int64
+	err = tx.QueryRow(rawQuery, fileID, userID, constants.FileStatus["processing"]).Scan(&copyID)
+	if err == nil {
+		err = enqueueJob(copyID, tx)
+	}
+	if err == nil {
+		err = retainBlob(file.Hash.String, file.Size.Int64, tx)
+	}
+	if err == nil {
+		err = insertFileSources(copyID, []int{fileID}, tx)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't copy a file")
+
+		return http.StatusInternalServerError, model.File{}, errors.New(constants.STRINGS["fileSaveFailed"])
+	}
+
+	file, err = getFileByID(int(copyID), db)
+
+	return http.StatusCreated, file, err
+}
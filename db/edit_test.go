@@ -0,0 +1,98 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+
+	"photos/constants"
+	model "photos/model"
+)
+
+// restoreRendering puts back the rotation, the edits and the status which the file had
+// before a test and removes its jobs, so later tests see it ready and claim none of them
+func restoreRendering(file model.File) {
+	db.Exec(`DELETE FROM jobs WHERE file = $1`, file.ID)
+
+	rawQuery := `UPDATE files SET rotation = $1, edits = $2::jsonb, status = $3 WHERE id = $4`
+	db.Exec(rawQuery, file.Rotation.Int64, encodeEdits(file.Edits), file.Status, file.ID)
+}
+
+func TestRotateFile(t *testing.T) {
+	userID := 19
+	files, _ := GetFiles(userID, db)
+	if len(files) == 0 {
+		t.Fatalf("GetFiles - %d, expected at least %d", len(files), 1)
+	}
+	fileID := int(files[0].ID.Int64)
+	defer restoreRendering(files[0])
+
+	if status, _, err := RotateFile(fileID, userID, 45, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("RotateFile = %d; want `%d` - not a multiple of 90 degrees", status, http.StatusBadRequest)
+	}
+
+	if status, _, _ := RotateFile(fileID, userID+1, 90, db); status != http.StatusForbidden {
+		t.Errorf("RotateFile = %d; want `%d` - user can't edit the file", status, http.StatusForbidden)
+	}
+
+	status, file, err := RotateFile(fileID, userID, -90, db)
+	if err != nil || status != http.StatusAccepted || file.Rotation.Int64 != 270 {
+		t.Errorf("RotateFile = %d; want `%d` rotated by %d", file.Rotation.Int64, 270, -90)
+	}
+
+	file, _ = getFileByID(fileID, db)
+	if file.Status.String != constants.FileStatus["processing"] {
+		t.Errorf("RotateFile - status %s, expected %s", file.Status.String, constants.FileStatus["processing"])
+	}
+}
+
+func TestEditStack(t *testing.T) {
+	userID := 19
+	files, _ := GetFiles(userID, db)
+	if len(files) < 2 {
+		t.Fatalf("GetFiles - %d, expected at least %d", len(files), 2)
+	}
+	fileID := int(files[1].ID.Int64)
+	defer restoreRendering(files[1])
+
+	invalid := model.Edit{Operation: "crop", X: 0.5, Width: 0.6, Height: 1}
+	if status, _, err := AddEdit(fileID, userID, invalid, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("AddEdit = %d; want `%d` - crop box outside the image", status, http.StatusBadRequest)
+	}
+
+	AddEdit(fileID, userID, model.Edit{Operation: "crop", X: 0.1, Y: 0.1, Width: 0.5, Height: 0.5}, db)
+	status, file, err := AddEdit(fileID, userID, model.Edit{Operation: "filter", Filter: "mono"}, db)
+	if err != nil || status != http.StatusAccepted || len(file.Edits) != 2 {
+		t.Errorf("AddEdit = %d; want `%d` edits", len(file.Edits), 2)
+	}
+
+	file, _ = getFileByID(fileID, db)
+	if len(file.Edits) != 2 || file.Edits[1].Filter != "mono" {
+		t.Errorf("getFileByID - %d edits, expected %d in their order", len(file.Edits), 2)
+	}
+
+	status, file, _ = UndoEdit(fileID, userID, db)
+	if status != http.StatusAccepted || len(file.Edits) != 1 || file.Edits[0].Operation != "crop" {
+		t.Errorf("UndoEdit = %d; want `%d` edit left", len(file.Edits), 1)
+	}
+
+	status, copied, err := CopyFile(fileID, userID, db)
+	if err != nil || status != http.StatusCreated || len(copied.Edits) != 1 || copied.Hash != file.Hash {
+		t.Errorf("CopyFile = %d; want `%d` with the edits and the original", status, http.StatusCreated)
+	}
+	if copied.ID.Valid {
+		defer removeSavedFile(copied.ID.Int64)
+	}
+
+	status, file, _ = RevertFile(fileID, userID, db)
+	if status != http.StatusAccepted || len(file.Edits) != 0 || file.Rotation.Int64 != 0 {
+		t.Errorf("RevertFile = %d edits; want `%d`", len(file.Edits), 0)
+	}
+
+	if status, _, err := UndoEdit(fileID, userID, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("UndoEdit = %d; want `%d` - nothing to undo", status, http.StatusBadRequest)
+	}
+
+	if copied, _ = getFileByID(int(copied.ID.Int64), db); len(copied.Edits) != 1 {
+		t.Errorf("RevertFile - copy has %d edits, expected %d", len(copied.Edits), 1)
+	}
+}
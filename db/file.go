@@ -1,70 +1,116 @@
 package db
 
 import (
-	"crypto/sha1"
 	"database/sql"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"photos/constants"
 	"photos/image"
 	model "photos/model"
-	"time"
+	"photos/storage"
+	"photos/video"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/guregu/null.v3"
 )
 
+// sniffLength is how much of the content is read to detect its type
+const sniffLength = 8192
+
 var selectFile = `
 	SELECT
-		id,
-		owner,
-		name,
-		hash,
-		size,
-		extension,
-		mime,
-		latitude,
-		longitude,
-		orientation,
-		model,
-		camera,
-		iso,
-		focal_length,
-		exposure_time,
-		f_number,
-		height,
-		width,
-		date
+		` + selectFileColumns("files") + `
 	FROM files
 `
 
-func hasFileAccess(userID, fileID int, db *sql.DB) bool {
-	var count int
-	rawQuery := "SELECT count(id) FROM files WHERE id = $1 AND owner = $2"
+// getFilePrivilege returns a privilege of the user to the file. The owner gets
+// `owner` privilege, users with whom the file is shared what is stored in `user_file`.
+// Trashed files are available only to the owner
+func getFilePrivilege(userID, fileID int, db *sql.DB) (int, bool) {
+	var privilege int
+	rawQuery := `
+		SELECT
+			CASE WHEN files.owner = $1 THEN $3 ELSE user_file.privilege END
+		FROM
+			files
+			LEFT JOIN user_file ON user_file.file = files.id AND user_file.user = $1
+		WHERE
+			files.id = $2
+			AND (files.owner = $1 OR (user_file.user = $1 AND files.trashed_at IS NULL))
+		ORDER BY 1 DESC
+		LIMIT 1;
+	`
 
-	row := db.QueryRow(rawQuery, fileID, userID)
-	err := row.Scan(&count)
+	row := db.QueryRow(rawQuery, userID, fileID, constants.FilePrivilege["owner"])
+	err := row.Scan(&privilege)
 	if err != nil {
-		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID)
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Send()
+		}
 
-		return false
+		return 0, false
 	}
 
-	return count > 0
+	return privilege, true
+}
+
+// hasFilePrivilege checks if an user is an owner of the file or the file is
+// shared with him with at least the given privilege
+func hasFilePrivilege(userID, fileID, privilege int, db *sql.DB) bool {
+	userPrivilege, ok := getFilePrivilege(userID, fileID, db)
+
+	return ok && userPrivilege >= privilege
 }
 
-// GetFiles gets all files which belongs to a user
+// hasFileAccess checks if an user is an owner of the file or the file is shared with him
+func hasFileAccess(userID, fileID int, db *sql.DB) bool {
+	return hasFilePrivilege(userID, fileID, constants.FilePrivilege["viewer"], db)
+}
+
+// GetFiles gets all files which belongs to a user except trashed ones
 func GetFiles(userID int, db *sql.DB) ([]model.File, error) {
-	query := selectFile + " WHERE owner = $1"
+	query := selectFile + " WHERE owner = $1 AND trashed_at IS NULL"
 	rows, _ := db.Query(query, userID)
 	defer rows.Close()
 
 	return filesScanner(rows)
 }
 
+// viewableFile is a condition which holds for files the user in the parameter can see:
+// owns them, they are shared with him or they are in an album he has access to. Only
+// the owner can see trashed files
+func viewableFile(user string) string {
+	return `(
+		files.owner = ` + user + `
+		OR files.trashed_at IS NULL AND files.id IN (SELECT file FROM user_file WHERE "user" = ` + user + `)
+		OR files.trashed_at IS NULL AND files.id IN (
+			SELECT album_file.file
+			FROM album_file
+			JOIN albums ON albums.id = album_file.album
+			LEFT JOIN user_album ON user_album.album = albums.id
+			WHERE albums.owner = ` + user + ` OR user_album.user = ` + user + `
+		)
+	)`
+}
+
+// GetViewableFile returns a file which the user can see: owns it, the file is shared
+// with him or it's in an album he has access to. Only the owner can see a trashed file
+func GetViewableFile(fileID, userID int, db *sql.DB) (int, model.File) {
+	query := selectFile + `WHERE files.id = $1 AND ` + viewableFile("$2")
+	file, err := fileScanner(db.QueryRow(query, fileID, userID))
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, model.File{}
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch a file")
+
+		return http.StatusInternalServerError, model.File{}
+	}
+
+	return http.StatusOK, file
+}
+
 func getFileByID(fileID int, db *sql.DB) (model.File, error) {
 	query := selectFile + " WHERE id = $1"
 	row := db.QueryRow(query, fileID)
@@ -72,26 +118,38 @@ func getFileByID(fileID int, db *sql.DB) (model.File, error) {
 	return fileScanner(row)
 }
 
-func saveFile(file *model.File, userID int, db *sql.DB) bool {
+// insertFile inserts the file, takes a reference to its blob and queues its processing
+// in the transaction. A staged blob is moved to its key last, right before the caller
+// commits, so a failed insert never leaves a blob behind. When the commit fails after
+// the move, the blob may be used by a concurrent upload of the same content and is
+// left for FindOrphanBlobs. Files from which a collage or an animation was generated
+// are linked as its sources. ID of the inserted row is set on the file
+func insertFile(file *model.File, staged string, sources []int, store storage.Storage, tx *sql.Tx) error {
 	sql := `
 		INSERT INTO files (
 			type, owner, name, hash, size, extension, 
 			mime, latitude, longitude, orientation, 
 			model, camera, iso, focal_length, 
 			exposure_time, f_number, height, 
-			width, date
+			width, date, status
 		) 
 		VALUES 
 			(
 				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 
-				$11, $12, $13, $14, $15, $16, $17, $18, $19
-			)	
+				$11, $12, $13, $14, $15, $16, $17, $18, $19, $20
+			)
+		RETURNING id
 	`
 
-	_, err := db.Exec(
+	fileType := constants.FileType["image"]
+	if file.Type.Valid {
+		fileType = file.Type.String
+	}
+
+	err := tx.QueryRow(
 		sql,
-		constants.FileType["image"],
-		userID,
+		fileType,
+		file.Owner,
 		file.Name,
 		file.Hash,
 		file.Size,
@@ -109,137 +167,314 @@ func saveFile(file *model.File, userID int, db *sql.DB) bool {
 		file.Height,
 		file.Width,
 		file.Date,
-	)
+		constants.FileStatus["processing"],
+	).Scan(&file.ID)
+
+	if err == nil {
+		err = enqueueJob(file.ID.Int64, tx)
+	}
 
+	if err == nil {
+		err = retainBlob(file.Hash.String, file.Size.Int64, tx)
+	}
+
+	if err == nil {
+		err = insertFileSources(file.ID.Int64, sources, tx)
+	}
+
+	if err == nil && staged != "" {
+		err = store.Move(staged, file.Hash.String)
+	}
+
+	return err
+}
+
+// deleteFile removes the row and releases its blob. It returns the hash and
+// whether it was the last reference to the blob
+func deleteFile(fileID int, db *sql.DB) (string, bool, error) {
+	var hash string
+
+	tx, err := db.Begin()
 	if err != nil {
-		log.Error().Err(err).Caller().Int("user", userID).Msg("Problem with inserting a file")
+		return "", false, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("DELETE FROM files WHERE id = $1 RETURNING hash", fileID).Scan(&hash)
+	if err != nil {
+		return "", false, err
+	}
 
-		return false
+	last, err := releaseBlob(hash, tx)
+	if err != nil {
+		return "", false, err
 	}
 
-	return true
+	return hash, last, tx.Commit()
 }
 
-// DeleteFiles deletes only those files which are owned by a user.
-// For deleting related entries in other tables `album_file`, `user_file`, etc.
-// db takes care. Returning id of not inserted files.
-// TODO: add physically removing from disc / storage
+// DeleteFiles moves files owned by the user to the trash. Trashed files are hidden
+// everywhere but the trash, their album memberships and shares are kept so restoring
+// brings them back. Returning id of not deleted files.
 func DeleteFiles(filesID []int, userID int, db *sql.DB) []int {
-	var notInserted []int
-	query := "DELETE FROM files WHERE id = $1"
+	var notDeleted []int
 
 	for _, file := range filesID {
-		if hasFileAccess(userID, file, db) {
-			result, err := db.Exec(query, file)
-			rowsNo, _ := result.RowsAffected()
-
-			if err != nil || rowsNo == 0 {
-				notInserted = append(notInserted, file)
-
-				log.Error().
-					Err(err).
-					Caller().
-					Int("user", userID).
-					Int("file", file).
-					Msg("Problem with deleting a file")
-			}
-		} else {
-			notInserted = append(notInserted, file)
+		if !hasFilePrivilege(userID, file, constants.FilePrivilege["owner"], db) {
+			notDeleted = append(notDeleted, file)
 
 			log.Warn().
 				Caller().
 				Int("user", userID).
 				Int("file", file).
 				Msg("Problem with deleting a file")
+			continue
+		}
+
+		rawQuery := `UPDATE files SET trashed_at = now() WHERE id = $1 AND trashed_at IS NULL`
+		if _, err := db.Exec(rawQuery, file); err != nil {
+			notDeleted = append(notDeleted, file)
+
+			log.Error().
+				Err(err).
+				Caller().
+				Int("user", userID).
+				Int("file", file).
+				Msg("Problem with deleting a file")
 		}
 	}
 
-	return notInserted
+	return notDeleted
+}
+
+// stagingKey returns a unique key under which a blob is written before it's committed
+func stagingKey() (string, error) {
+	token, _, err := createToken()
+
+	return storage.StagingPrefix + token, err
 }
 
+// writeFile stages the original of the size in the storage and returns its staging
+// key, see insertFile. Metadata and renditions are left for the processing job. Blobs
+// which are already stored, e.g. uploaded by another user, aren't written again and
+// the key is empty. Such a blob stays locked in the transaction the file is inserted in
 func writeFile(
-	file multipart.File,
-	FileHeader *multipart.FileHeader,
+	content io.Reader,
+	size int64,
+	name string,
+	mimeType string,
+	extension string,
+	hash string,
 	userID int,
-	uploadDir string,
-	db *sql.DB,
-) (*model.File, error) {
+	store storage.Storage,
+	tx *sql.Tx,
+) (*model.File, string, error) {
+	fileInfo := model.File{
+		Name:      null.StringFrom(name),
+		Hash:      null.StringFrom(hash),
+		Owner:     null.IntFrom(int64(userID)),
+		Size:      null.IntFrom(size),
+		MimeType:  null.StringFrom(mimeType),
+		Extension: null.StringFrom(extension),
+	}
 
-	data, err := ioutil.ReadAll(file)
+	stored, err := lockBlob(hash, tx)
 	if err != nil {
-		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't read a file")
+		log.Error().Err(err).Caller().Int("user", userID).Str("hash", hash).Msg("Can't lock a blob")
 
-		return &model.File{}, err
+		return &model.File{}, "", err
+	}
+	if stored {
+		return &fileInfo, "", nil
 	}
 
-	nullHash, _ := createFileName(FileHeader.Filename, userID, db)
-	hash := nullHash.ValueOrZero()
-
-	err = ioutil.WriteFile(uploadDir+hash, data, 0666)
+	staged, err := stagingKey()
+	if err == nil {
+		err = store.Put(staged, content, size, mimeType)
+	}
 	if err != nil {
 		log.Error().Err(err).Caller().Int("user", userID).Str("hash", hash).Msg("Can't write a file")
+		store.Delete(staged)
 
-		return &model.File{}, err
+		return &model.File{}, "", err
 	}
 
-	fileInfo, _ := image.ExtractExif(data)
-	fileInfo.Name = null.StringFrom(FileHeader.Filename)
-	fileInfo.Hash = nullHash
-	image.ResizeImage(data, fileInfo, uploadDir)
+	return &fileInfo, staged, nil
+}
 
-	return &fileInfo, nil
+// uploadFailed describes a file which couldn't be saved. Details are only logged
+func uploadFailed(name string) model.UploadResult {
+	return model.UploadResult{
+		Name:   name,
+		Status: constants.UploadStatus["failed"],
+		Error:  constants.STRINGS["fileSaveFailed"],
+	}
 }
 
-func createFileName(name string, user int, db *sql.DB) (null.String, error) {
-	today := time.Now()
-	now := today.UnixNano()
-	fileName := fmt.Sprintf("%s_%d_%d", name, user, now)
+// saveUpload saves content of a single uploaded file, an image or a video. Its type is
+// sniffed from the content, the original is streamed to the storage untouched whatever
+// format it is. A file which the user already has isn't saved again, when it's in the
+// trash it is restored. The file is inserted in the transaction which the caller commits
+// when the file is created. A failure, even a panic, removes what was staged
+func saveUpload(
+	content io.ReadSeeker,
+	size int64,
+	name string,
+	userID int,
+	store storage.Storage,
+	tx *sql.Tx,
+	db *sql.DB,
+) (result model.UploadResult) {
+	staged := ""
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Caller().Int("user", userID).Str("name", name).Interface("panic", r).Msg("Saving a file panicked")
+			result = uploadFailed(name)
+		}
+
+		if result.Status == constants.UploadStatus["failed"] && staged != "" {
+			if err := store.Delete(staged); err != nil {
+				log.Error().Err(err).Caller().Str("key", staged).Msg("Can't remove a staged file")
+			}
+		}
+	}()
+
+	header := make([]byte, sniffLength)
+	read, err := io.ReadFull(content, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		log.Error().Err(err).Caller().Int("user", userID).Str("name", name).Msg("Can't read a file")
+
+		return uploadFailed(name)
+	}
+	header = header[:read]
 
-	h := sha1.New()
-	_, err := io.WriteString(h, fileName)
+	fileType := constants.FileType["image"]
+	mimeType, extension, ok := image.SniffType(header, name)
+	if !ok {
+		fileType = constants.FileType["video"]
+		mimeType, extension, ok = video.SniffType(header)
+	}
+	if !ok {
+		return model.UploadResult{
+			Name:   name,
+			Status: constants.UploadStatus["rejected"],
+			Reason: constants.STRINGS["fileFormatInvalid"],
+		}
+	}
+
+	hash, err := readerHash(content)
 	if err != nil {
-		log.Error().
-			Err(err).
-			Caller().
-			Int("user", user).
-			Str("name", name).
-			Msg("Can't create a file name")
+		log.Error().Err(err).Caller().Int("user", userID).Str("name", name).Msg("Can't read a file")
 
-		return null.NewString("", false), err
+		return uploadFailed(name)
+	}
+	if fileID, ok := getUserFileByHash(hash, userID, db); ok {
+		RestoreFiles([]int{fileID}, userID, db)
+		duplicateOf := int64(fileID)
+
+		return model.UploadResult{
+			Name:        name,
+			Status:      constants.UploadStatus["duplicate"],
+			DuplicateOf: &duplicateOf,
+		}
 	}
 
-	return null.StringFrom(fmt.Sprintf("%x", h.Sum(nil))), nil
-}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("name", name).Msg("Can't read a file")
 
-// ProcessFiles saves on disk file and than insert data to db. It accepts only jpeg/png so far.
-func ProcessFiles(files []*multipart.FileHeader, userID int, uploadDir string, db *sql.DB) int {
-	for _, file := range files {
-		f, err := file.Open()
+		return uploadFailed(name)
+	}
 
-		if err != nil {
-			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't open a file")
+	fileInfo, staged, err := writeFile(content, size, name, mimeType, extension, hash, userID, store, tx)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("name", name).Msg("Failed write a file")
+
+		return uploadFailed(name)
+	}
+	fileInfo.Type = null.StringFrom(fileType)
 
-			return http.StatusInternalServerError
+	if err := insertFile(fileInfo, staged, nil, store, tx); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Problem with inserting a file")
+
+		return uploadFailed(name)
+	}
+
+	return model.UploadResult{
+		Name:   name,
+		Status: constants.UploadStatus["created"],
+		File:   &fileInfo.ID.Int64,
+	}
+}
+
+// uploadStatus summarizes results of a batch. When some files were saved and others
+// weren't the batch is a partial success, clients retry only items which failed
+func uploadStatus(results []model.UploadResult) int {
+	succeeded, rejected, failed := 0, 0, 0
+	for _, result := range results {
+		switch result.Status {
+		case constants.UploadStatus["created"], constants.UploadStatus["duplicate"]:
+			succeeded++
+		case constants.UploadStatus["rejected"]:
+			rejected++
+		default:
+			failed++
 		}
+	}
 
-		defer f.Close()
-		mimeType := file.Header.Get("Content-Type")
+	switch {
+	case len(results) == 0:
+		return http.StatusBadRequest
+	case succeeded == len(results):
+		return http.StatusAccepted
+	case succeeded > 0:
+		return http.StatusMultiStatus
+	case failed > 0:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
 
-		if mimeType == "image/jpeg" || mimeType == "image/png" {
-			fileInfo, err := writeFile(f, file, userID, uploadDir, db)
+// saveMultipartFile saves a file of a multipart upload in its own transaction,
+// see saveUpload
+func saveMultipartFile(file *multipart.FileHeader, userID int, store storage.Storage, db *sql.DB) model.UploadResult {
+	f, err := file.Open()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't open a file")
 
-			if err != nil {
-				log.Error().Err(err).Caller().Int("user", userID).Msg("Failed write a file")
+		return uploadFailed(file.Filename)
+	}
+	defer f.Close()
 
-				return http.StatusInternalServerError
-			}
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't start a transaction")
 
-			// TODO: after fail remove the file
-			saveFile(fileInfo, userID, db)
-		} else {
-			return http.StatusBadRequest
-		}
+		return uploadFailed(file.Filename)
+	}
+	defer tx.Rollback()
+
+	result := saveUpload(f, file.Size, file.Filename, userID, store, tx, db)
+	if result.Status != constants.UploadStatus["created"] {
+		return result
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Problem with inserting a file")
+
+		return uploadFailed(file.Filename)
+	}
+
+	return result
+}
+
+// ProcessFiles saves files in the storage and than insert data to db, see saveUpload.
+// Saved files are processing until a worker creates their renditions, see RunNextJob.
+// Every file gets its own result, one broken file doesn't stop the others
+func ProcessFiles(files []*multipart.FileHeader, userID int, store storage.Storage, db *sql.DB) (int, []model.UploadResult) {
+	results := []model.UploadResult{}
+	for _, file := range files {
+		results = append(results, saveMultipartFile(file, userID, store, db))
 	}
 
-	return http.StatusOK
+	return uploadStatus(results), results
 }
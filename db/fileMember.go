@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"net/http"
+
+	constants "photos/constants"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+func isFileMember(memberID, fileID int, db *sql.DB) bool {
+	var count int
+	rawQuery := `SELECT count(id) FROM user_file WHERE "user" = $1 AND file = $2`
+
+	row := db.QueryRow(rawQuery, memberID, fileID)
+	err := row.Scan(&count)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", memberID).Int("file", fileID).Send()
+
+		return false
+	}
+
+	return count > 0
+}
+
+// GetSharedFiles returns files which other users shared with the user
+func GetSharedFiles(userID int, db *sql.DB) ([]model.File, error) {
+	query := selectFile + `
+		WHERE
+			owner != $1
+			AND trashed_at IS NULL
+			AND id IN (SELECT file FROM user_file WHERE "user" = $1)
+	`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return []model.File{}, err
+	}
+	defer rows.Close()
+
+	return filesScanner(rows)
+}
+
+// GetFileMembers returns users with whom the file is shared. Only the owner and editors can see them
+func GetFileMembers(fileID, userID int, db *sql.DB) (int, []model.Member) {
+	members := []model.Member{}
+	if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["editor"], db) {
+		return http.StatusForbidden, members
+	}
+
+	rawQuery := `
+		SELECT
+			users.id,
+			users.first_name,
+			users.last_name,
+			users.email,
+			max(user_file.privilege)
+		FROM
+			user_file
+			JOIN users ON users.id = user_file.user
+		WHERE
+			user_file.file = $1
+		GROUP BY users.id
+		ORDER BY users.id;
+	`
+
+	rows, err := db.Query(rawQuery, fileID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch members")
+
+		return http.StatusInternalServerError, members
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var privilege int
+		member := model.Member{}
+		err := rows.Scan(&member.User, &member.FirstName, &member.LastName, &member.Email, &privilege)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't parse members")
+
+			return http.StatusInternalServerError, members
+		}
+
+		member.Privilege = getPrivilegeName(constants.FilePrivilege, privilege)
+		members = append(members, member)
+	}
+
+	return http.StatusOK, members
+}
+
+// AddFileMember shares the file with another user. Only the owner can do it.
+// When the file is already shared with the user, the privilege is changed
+func AddFileMember(fileID, userID, memberID int, privilegeName string, db *sql.DB) (int, error) {
+	privilege, err := parsePrivilege(constants.FilePrivilege, privilegeName)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["owner"], db) {
+		return http.StatusForbidden, nil
+	}
+
+	if _, err := GetUser(memberID, db); err != nil || memberID == userID {
+		return http.StatusBadRequest, nil
+	}
+
+	if isFileMember(memberID, fileID, db) {
+		return ChangeFileMember(fileID, userID, memberID, privilegeName, db)
+	}
+
+	rawQuery := `INSERT INTO user_file("user", file, privilege) VALUES($1, $2, $3)`
+	_, err = db.Exec(rawQuery, memberID, fileID, privilege)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Int("file", fileID).Send()
+
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusCreated, nil
+}
+
+// ChangeFileMember changes a privilege of the member. Only the owner can do it
+func ChangeFileMember(fileID, userID, memberID int, privilegeName string, db *sql.DB) (int, error) {
+	privilege, err := parsePrivilege(constants.FilePrivilege, privilegeName)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["owner"], db) {
+		return http.StatusForbidden, nil
+	}
+
+	rawQuery := `UPDATE user_file SET privilege = $1, updated_at = now() WHERE "user" = $2 AND file = $3`
+	result, err := db.Exec(rawQuery, privilege, memberID, fileID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Int("file", fileID).Send()
+
+		return http.StatusInternalServerError, err
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound, nil
+	}
+
+	return http.StatusOK, nil
+}
+
+// RemoveFileMember revokes the share. The owner can remove anyone, other members
+// can only remove themselves
+func RemoveFileMember(fileID, userID, memberID int, db *sql.DB) int {
+	if userID != memberID && !hasFilePrivilege(userID, fileID, constants.FilePrivilege["owner"], db) {
+		return http.StatusForbidden
+	}
+
+	rawQuery := `DELETE FROM user_file WHERE "user" = $1 AND file = $2`
+	result, err := db.Exec(rawQuery, memberID, fileID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("member", memberID).Int("file", fileID).Send()
+
+		return http.StatusInternalServerError
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound
+	}
+
+	return http.StatusOK
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddFileMember(t *testing.T) {
+	ownerID := 2
+	memberID := 3
+	fileID := 36
+	albumID := "35"
+
+	status, _ := AddFileMember(fileID, memberID, 4, "viewer", db)
+	if status != http.StatusForbidden {
+		t.Errorf("AddFileMember - status: %d, expected %d - not an owner", status, http.StatusForbidden)
+	}
+
+	status, err := AddFileMember(fileID, ownerID, memberID, "viewer", db)
+	files, _ := GetSharedFiles(memberID, db)
+	if status != http.StatusCreated || err != nil || len(files) != 1 || !hasFileAccess(memberID, fileID, db) {
+		t.Errorf("AddFileMember - status: %d, expected %d - owner shares the file", status, http.StatusCreated)
+	}
+
+	status = AddFilesToAlbum(albumID, memberID, []int{fileID}, db)
+	if status != http.StatusForbidden {
+		t.Errorf("AddFilesToAlbum - status: %d, expected %d - viewer of the file", status, http.StatusForbidden)
+	}
+
+	status, _ = AddFileMember(fileID, ownerID, memberID, "editor", db)
+	albumStatus := AddFilesToAlbum(albumID, memberID, []int{fileID}, db)
+	if status != http.StatusOK || albumStatus != http.StatusOK || !isFileInAlbum(fileID, albumID, db) {
+		t.Errorf("AddFilesToAlbum - status: %d, expected %d - editor of the file", albumStatus, http.StatusOK)
+	}
+
+	notDeleted := DeleteFiles([]int{fileID}, memberID, db)
+	if len(notDeleted) != 1 {
+		t.Errorf("DeleteFiles - editor can't delete the file")
+	}
+}
+
+func TestRemoveFileMember(t *testing.T) {
+	ownerID := 2
+	memberID := 5
+	fileID := 39
+
+	AddFileMember(fileID, ownerID, memberID, "viewer", db)
+	_, members := GetFileMembers(fileID, ownerID, db)
+	if len(members) != 1 || members[0].User != memberID {
+		t.Errorf("GetFileMembers - %d, expected %d", len(members), 1)
+	}
+
+	status := RemoveFileMember(fileID, ownerID, memberID, db)
+	if status != http.StatusOK || hasFileAccess(memberID, fileID, db) {
+		t.Errorf("RemoveFileMember - status: %d, expected %d", status, http.StatusOK)
+	}
+}
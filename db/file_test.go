@@ -1,9 +1,27 @@
 package db
 
 import (
+	"bytes"
+	"net/http"
+	"strings"
 	"testing"
+
+	"photos/constants"
+	model "photos/model"
+	"photos/storage"
+
+	"gopkg.in/guregu/null.v3"
 )
 
+// removeSavedFile deletes a file saved by a test with its queued job and its blob, so later
+// tests neither claim the job nor count the file
+func removeSavedFile(fileID int64) {
+	hash, last, err := deleteFile(int(fileID), db)
+	if err == nil && last {
+		store.Delete(hash)
+	}
+}
+
 func TestGetFiles(t *testing.T) {
 	userID := 17
 	files, err := GetFiles(userID, db)
@@ -26,3 +44,109 @@ func TestDeleteFiles(t *testing.T) {
 		t.Errorf("GetFiles = %d; want `%d`, user isn't the owner", len(files), 3)
 	}
 }
+
+func TestGetViewableFile(t *testing.T) {
+	status, file := GetViewableFile(3, 10, db)
+	if status != http.StatusOK || file.ID.ValueOrZero() != 3 {
+		t.Errorf("GetViewableFile - status: %d, expected %d - owned file", status, http.StatusOK)
+	}
+
+	status, file = GetViewableFile(414, 10, db)
+	if status != http.StatusOK || file.ID.ValueOrZero() != 414 {
+		t.Errorf("GetViewableFile - status: %d, expected %d - file in shared album", status, http.StatusOK)
+	}
+
+	_, stranger, _ := CreateUser("Stranger", "Doe", "stranger@example.com", "secret-password", db)
+	status, _ = GetViewableFile(414, stranger.ID, db)
+	if status != http.StatusNotFound {
+		t.Errorf("GetViewableFile - status: %d, expected %d - no access", status, http.StatusNotFound)
+	}
+}
+
+func TestSaveUpload(t *testing.T) {
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+
+	result := saveUpload(strings.NewReader("text"), 4, "notes.jpg", 10, store, tx, db)
+	if result.Status != constants.UploadStatus["rejected"] || result.Reason == "" {
+		t.Errorf("saveUpload - status %s, expected %s", result.Status, constants.UploadStatus["rejected"])
+	}
+}
+
+func TestUploadStatus(t *testing.T) {
+	created := model.UploadResult{Status: constants.UploadStatus["created"]}
+	duplicate := model.UploadResult{Status: constants.UploadStatus["duplicate"]}
+	rejected := model.UploadResult{Status: constants.UploadStatus["rejected"]}
+	failed := model.UploadResult{Status: constants.UploadStatus["failed"]}
+
+	cases := []struct {
+		results []model.UploadResult
+		status  int
+	}{
+		{[]model.UploadResult{created, duplicate}, http.StatusAccepted},
+		{[]model.UploadResult{created, rejected}, http.StatusMultiStatus},
+		{[]model.UploadResult{rejected, failed}, http.StatusInternalServerError},
+		{[]model.UploadResult{rejected}, http.StatusBadRequest},
+		{[]model.UploadResult{}, http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		if status := uploadStatus(c.results); status != c.status {
+			t.Errorf("uploadStatus = %d; want `%d`", status, c.status)
+		}
+	}
+}
+
+func TestSaveFileStaged(t *testing.T) {
+	data := []byte("staged content")
+	hash := contentHash(data)
+
+	tx, _ := db.Begin()
+	file, staged, err := writeFile(bytes.NewReader(data), int64(len(data)), "staged.jpg", "image/jpeg", "jpg", hash, 10, store, tx)
+	if err != nil || staged == "" {
+		t.Fatalf("writeFile - staged key %s - error: %s", staged, err)
+	}
+
+	file.Owner = null.IntFrom(9999)
+	if err := insertFile(file, staged, nil, store, tx); err == nil {
+		t.Errorf("insertFile - user doesn't exist")
+	}
+	tx.Rollback()
+	if _, err := store.Stat(hash); err != storage.ErrNotExist {
+		t.Errorf("insertFile - failed insert must not commit the blob")
+	}
+
+	tx, _ = db.Begin()
+	defer tx.Rollback()
+	file.Owner = null.IntFrom(10)
+	if err := insertFile(file, staged, nil, store, tx); err != nil || tx.Commit() != nil {
+		t.Fatalf("insertFile - file should be saved - error: %s", err)
+	}
+	defer removeSavedFile(file.ID.Int64)
+
+	_, stagedErr := store.Stat(staged)
+	if _, err := store.Stat(hash); err != nil || stagedErr != storage.ErrNotExist {
+		t.Errorf("insertFile - blob should be moved to its key - error: %s", err)
+	}
+}
+
+func TestWriteFileLocksBlob(t *testing.T) {
+	files, _ := GetFiles(10, db)
+	if len(files) == 0 {
+		t.Skip("the user has no files")
+	}
+	hash := files[0].Hash.String
+
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	_, staged, err := writeFile(strings.NewReader(""), files[0].Size.Int64, "copy.jpg", "image/jpeg", "jpg", hash, 9, store, tx)
+	if err != nil || staged != "" {
+		t.Fatalf("writeFile - staged key %q - error: %s; want the stored blob", staged, err)
+	}
+
+	var locked bool
+	rawQuery := `SELECT count(*) = 0 FROM blobs WHERE hash = $1 FOR UPDATE SKIP LOCKED`
+	if err := db.QueryRow(rawQuery, hash).Scan(&locked); err != nil || !locked {
+		t.Errorf("writeFile - the blob should stay locked until the file is inserted - error: %s", err)
+	}
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"photos/constants"
+	"photos/image"
+	model "photos/model"
+	"photos/storage"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Limits of generated files. Sources are generated from in the request and all of them
+// are held in memory at once, so their count and their size together are capped
+const (
+	sourcesMaxSize         = 256 << 20
+	collageMaxFiles        = 16
+	collageDefaultCellSize = 512
+	collageMaxCellSize     = 2048
+	collageMinCellSize     = 64
+	collageMaxSpacing      = 200
+	animationMaxFrames     = 24
+	animationDefaultWidth  = 800
+	animationMaxWidth      = 1920
+	animationMinWidth      = 64
+	animationDefaultDelay  = 200 * time.Millisecond
+	animationMinDelay      = 20 * time.Millisecond
+	animationMaxDelay      = 10 * time.Second
+)
+
+// insertFileSources links the generated file to files it was made of, in their order
+func insertFileSources(fileID int64, sources []int, tx *sql.Tx) error {
+	rawQuery := `INSERT INTO file_source (file, source, position) VALUES ($1, $2, $3)`
+	for position, source := range sources {
+		if _, err := tx.Exec(rawQuery, fileID, source, position); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadSources reads originals of files from which a file is generated with their rotations and
+// edits. Every file has to be an image which the user can see. All files are checked before
+// any is read
+func loadSources(filesID []int, userID int, store storage.Storage, db *sql.DB) (int, []image.Source, error) {
+	images := []image.Source{}
+	files := []model.File{}
+	size := int64(0)
+	for _, fileID := range filesID {
+		status, file := GetViewableFile(fileID, userID, db)
+		if status == http.StatusInternalServerError {
+			return status, images, errors.New(constants.STRINGS["fileSaveFailed"])
+		}
+		if status != http.StatusOK || file.TrashedAt.Valid || file.Type.String != constants.FileType["image"] {
+			return http.StatusBadRequest, images, errors.New(constants.STRINGS["sourceFileInvalid"])
+		}
+
+		size += file.Size.Int64
+		files = append(files, file)
+	}
+	if size > sourcesMaxSize {
+		return http.StatusRequestEntityTooLarge, images, fmt.Errorf(constants.STRINGS["sourcesTooLarge"], sourcesMaxSize)
+	}
+
+	for _, file := range files {
+		fileID := int(file.ID.Int64)
+		f, err := store.Get(file.Hash.String)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't open a source file")
+
+			return http.StatusInternalServerError, images, err
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't read a source file")
+
+			return http.StatusInternalServerError, images, err
+		}
+
+		images = append(images, image.Source{Data: data, Rotation: file.Rotation.Int64, Edits: file.Edits})
+	}
+
+	return http.StatusOK, images, nil
+}
+
+// saveGenerated saves a collage or an animation like an uploaded file, its renditions are
+// created by a worker. Generating the same content again returns the existing file
+func saveGenerated(
+	rendered image.RenderedImage,
+	name string,
+	fileType string,
+	sources []int,
+	userID int,
+	store storage.Storage,
+	db *sql.DB,
+) (int, model.File, error) {
+	hash := contentHash(rendered.Data)
+	if fileID, ok := getUserFileByHash(hash, userID, db); ok {
+		RestoreFiles([]int{fileID}, userID, db)
+		file, err := getFileByID(fileID, db)
+
+		return http.StatusOK, file, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't start a transaction")
+
+		return http.StatusInternalServerError, model.File{}, errors.New(constants.STRINGS["fileSaveFailed"])
+	}
+	defer tx.Rollback()
+
+	fileInfo, staged, err := writeFile(
+		bytes.NewReader(rendered.Data),
+		int64(len(rendered.Data)),
+		name+"."+rendered.Format.Extension,
+		rendered.Format.MimeType,
+		rendered.Format.Extension,
+		hash,
+		userID,
+		store,
+		tx,
+	)
+	if err != nil {
+		return http.StatusInternalServerError, model.File{}, errors.New(constants.STRINGS["fileSaveFailed"])
+	}
+	fileInfo.Type = null.StringFrom(fileType)
+
+	err = insertFile(fileInfo, staged, sources, store, tx)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Problem with inserting a file")
+		if staged != "" {
+			store.Delete(staged)
+		}
+
+		return http.StatusInternalServerError, model.File{}, errors.New(constants.STRINGS["fileSaveFailed"])
+	}
+
+	file, err := getFileByID(int(fileInfo.ID.Int64), db)
+
+	return http.StatusCreated, file, err
+}
+
+// CreateCollage composes images to a grid and saves it as a new file of the COLLAGE type.
+// Zero columns lay the images out in a square grid, zero cell size and empty background
+// use defaults
+func CreateCollage(
+	filesID []int,
+	layout image.CollageLayout,
+	userID int,
+	store storage.Storage,
+	db *sql.DB,
+) (int, model.File, error) {
+	if len(filesID) < 2 || len(filesID) > collageMaxFiles {
+		return http.StatusBadRequest, model.File{}, fmt.Errorf(constants.STRINGS["collageFilesInvalid"], 2, collageMaxFiles)
+	}
+
+	if layout.Columns == 0 {
+		layout.Columns = int(math.Ceil(math.Sqrt(float64(len(filesID)))))
+	}
+	if layout.CellSize == 0 {
+		layout.CellSize = collageDefaultCellSize
+	}
+	if layout.Background == "" {
+		layout.Background = "white"
+	}
+	if layout.Columns < 1 ||
+		layout.Columns > len(filesID) ||
+		layout.CellSize < collageMinCellSize ||
+		layout.CellSize > collageMaxCellSize ||
+		layout.Spacing < 0 ||
+		layout.Spacing > collageMaxSpacing {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["collageLayoutInvalid"])
+	}
+
+	status, images, err := loadSources(filesID, userID, store, db)
+	if err != nil {
+		return status, model.File{}, err
+	}
+
+	rendered, err := image.Collage(images, layout)
+	if err == image.ErrInvalidColor {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["collageLayoutInvalid"])
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate a collage")
+
+		return http.StatusInternalServerError, model.File{}, err
+	}
+
+	return saveGenerated(rendered, "Collage", constants.FileType["collage"], filesID, userID, store, db)
+}
+
+// CreateAnimation makes an animated GIF or WebP of images, e.g. a burst sequence, and saves
+// it as a new file of the ANIMATION type. Zero width and delay use defaults
+func CreateAnimation(
+	filesID []int,
+	options image.AnimationOptions,
+	userID int,
+	store storage.Storage,
+	db *sql.DB,
+) (int, model.File, error) {
+	if len(filesID) < 2 || len(filesID) > animationMaxFrames {
+		return http.StatusBadRequest, model.File{}, fmt.Errorf(constants.STRINGS["animationFilesInvalid"], 2, animationMaxFrames)
+	}
+
+	if options.Width == 0 {
+		options.Width = animationDefaultWidth
+	}
+	if options.Delay == 0 {
+		options.Delay = animationDefaultDelay
+	}
+	if options.Format.Name == "" ||
+		options.Width < animationMinWidth ||
+		options.Width > animationMaxWidth ||
+		options.Delay < animationMinDelay ||
+		options.Delay > animationMaxDelay {
+		return http.StatusBadRequest, model.File{}, errors.New(constants.STRINGS["animationOptionsInvalid"])
+	}
+
+	status, images, err := loadSources(filesID, userID, store, db)
+	if err != nil {
+		return status, model.File{}, err
+	}
+
+	rendered, err := image.Animate(images, options)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate an animation")
+
+		return http.StatusInternalServerError, model.File{}, err
+	}
+
+	return saveGenerated(rendered, "Animation", constants.FileType["animation"], filesID, userID, store, db)
+}
+
+// GetFileSources returns files from which the file was generated, in their order. Sources
+// which were purged or which the user can't see are left out
+func GetFileSources(fileID, userID int, db *sql.DB) (int, []model.File) {
+	files := []model.File{}
+	if status, _ := GetViewableFile(fileID, userID, db); status != http.StatusOK {
+		return status, files
+	}
+
+	rows, err := db.Query(`SELECT source FROM file_source WHERE file = $1 AND source IS NOT NULL ORDER BY position`, fileID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch sources")
+
+		return http.StatusInternalServerError, files
+	}
+	defer rows.Close()
+
+	sources := []int{}
+	for rows.Next() {
+		var source int
+		if err := rows.Scan(&source); err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't parse sources")
+
+			return http.StatusInternalServerError, files
+		}
+
+		sources = append(sources, source)
+	}
+
+	for _, source := range sources {
+		if status, file := GetViewableFile(source, userID, db); status == http.StatusOK && !file.TrashedAt.Valid {
+			files = append(files, file)
+		}
+	}
+
+	return http.StatusOK, files
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"photos/constants"
+	"photos/image"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestCreateCollageInvalid(t *testing.T) {
+	userID := 19
+
+	status, _, err := CreateCollage([]int{825}, image.CollageLayout{}, userID, store, db)
+	if status != http.StatusBadRequest || err == nil {
+		t.Errorf("CreateCollage = %d; want `%d` - single file", status, http.StatusBadRequest)
+	}
+
+	layout := image.CollageLayout{Columns: 3}
+	status, _, err = CreateCollage([]int{825, 826}, layout, userID, store, db)
+	if status != http.StatusBadRequest || err == nil {
+		t.Errorf("CreateCollage = %d; want `%d` - more columns than files", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetFileSources(t *testing.T) {
+	userID := 19
+	files, _ := GetFiles(userID, db)
+	if len(files) < 2 {
+		t.Fatalf("GetFiles - %d, expected at least %d", len(files), 2)
+	}
+	sources := []int{int(files[1].ID.Int64), int(files[0].ID.Int64)}
+
+	data := []byte("collage content")
+	tx, _ := db.Begin()
+	defer tx.Rollback()
+	file, staged, err := writeFile(bytes.NewReader(data), int64(len(data)), "Collage.jpg", "image/jpeg", "jpg", contentHash(data), userID, store, tx)
+	if err != nil {
+		t.Fatalf("writeFile - error: %s", err)
+	}
+	file.Type = null.StringFrom(constants.FileType["collage"])
+	file.Owner = null.IntFrom(int64(userID))
+	if err := insertFile(file, staged, sources, store, tx); err != nil || tx.Commit() != nil {
+		t.Fatalf("insertFile - collage should be saved - error: %s", err)
+	}
+	defer removeSavedFile(file.ID.Int64)
+
+	status, result := GetFileSources(int(file.ID.Int64), userID, db)
+	if status != http.StatusOK || len(result) != 2 || int(result[0].ID.Int64) != sources[0] {
+		t.Errorf("GetFileSources = %d; want `%d` in the order of creation", len(result), 2)
+	}
+
+	if status, _ := GetFileSources(int(file.ID.Int64), userID+1, db); status != http.StatusNotFound {
+		t.Errorf("GetFileSources = %d; want `%d` - user can't see the file", status, http.StatusNotFound)
+	}
+}
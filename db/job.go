@@ -0,0 +1,560 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"photos/constants"
+	"photos/geocode"
+	"photos/image"
+	model "photos/model"
+	"photos/storage"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// jobMaxAttempts is how many times a job runs before the file is marked as failed
+const jobMaxAttempts = 5
+
+// jobRetryDelay is the delay before the first retry, it doubles with every attempt
+const jobRetryDelay = 30 * time.Second
+
+// jobMaxRetryDelay caps the delay between retries
+const jobMaxRetryDelay = time.Hour
+
+// jobLockTimeout is how long a job's lock lasts without being refreshed before another
+// worker takes the job over, e.g. when the worker running it crashed
+const jobLockTimeout = 10 * time.Minute
+
+// jobHeartbeat is how often a running job refreshes its lock, so a long transcode isn't
+// taken over
+const jobHeartbeat = jobLockTimeout / 5
+
+// errJobTakenOver is returned when the job's lock timed out and another worker runs it
+var errJobTakenOver = errors.New("job was taken over by another worker")
+
+// errJobTimedOut fails a job taken over after its last attempt, each takeover is an attempt
+var errJobTimedOut = errors.New("job timed out")
+
+// enqueueJob queues processing of the file. A file has at most one queued job, queuing
+// it again runs that job as soon as possible, so repeated edits are rendered once
+func enqueueJob(fileID int64, tx *sql.Tx) error {
+	rawQuery := `
+		INSERT INTO jobs (file, status)
+		VALUES ($1, $2)
+		ON CONFLICT (file) WHERE status = '` + constants.JobStatus["queued"] + `'
+		DO UPDATE SET run_at = now(), attempts = 0, last_error = NULL, updated_at = now()
+	`
+	_, err := tx.Exec(rawQuery, fileID, constants.JobStatus["queued"])
+
+	return err
+}
+
+// claimJob locks the next due job. SKIP LOCKED lets workers run the query concurrently
+// without waiting for each other or taking the same job. A job waits while another job
+// of its file runs, so a file is never processed by two workers at once. Attempts tell
+// apart claims of the same job, see finishJob
+func claimJob(db *sql.DB) (model.Job, bool, error) {
+	job := model.Job{}
+	rawQuery := `
+		UPDATE jobs
+		SET status = $1, attempts = attempts + 1, locked_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id
+			FROM jobs
+			WHERE
+				(
+					(status = $2 AND run_at <= now())
+					OR (status = $1 AND locked_at < now() - make_interval(secs => $3))
+				)
+				AND NOT EXISTS (
+					SELECT 1
+					FROM jobs running
+					WHERE
+						running.file = jobs.file
+						AND running.id <> jobs.id
+						AND running.status = $1
+						AND running.locked_at >= now() - make_interval(secs => $3)
+				)
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, file, status, attempts, last_error, run_at, updated_at
+	`
+
+	row := db.QueryRow(
+		rawQuery,
+		constants.JobStatus["running"],
+		constants.JobStatus["queued"],
+		jobLockTimeout.Seconds(),
+	)
+	err := row.Scan(&job.ID, &job.File, &job.Status, &job.Attempts, &job.LastError, &job.RunAt, &job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return job, false, nil
+	}
+
+	return job, err == nil, err
+}
+
+// retryDelay returns the backoff before the next attempt
+func retryDelay(attempts int) time.Duration {
+	delay := time.Duration(float64(jobRetryDelay) * math.Pow(2, float64(attempts-1)))
+	if delay > jobMaxRetryDelay || delay <= 0 {
+		return jobMaxRetryDelay
+	}
+
+	return delay
+}
+
+// failJob schedules a retry of the job or, when no attempts are left, marks it and its file
+// as failed. When a newer job of the file is queued, it's retried by that one and the file
+// is left processing. Nothing changes when the job was taken over by another worker
+func failJob(job model.Job, jobErr error, db *sql.DB) error {
+	// A newer job of the file is queued
+	queued := `EXISTS (SELECT 1 FROM jobs queued WHERE queued.file = $1 AND queued.status = $2)`
+
+	if job.Attempts < jobMaxAttempts {
+		rawQuery := `
+			UPDATE jobs
+			SET status = $2, last_error = $3, run_at = $4, locked_at = NULL, updated_at = now()
+			WHERE id = $5 AND status = $6 AND attempts = $7 AND NOT ` + queued
+		runAt := time.Now().Add(retryDelay(job.Attempts))
+		result, err := db.Exec(
+			rawQuery,
+			job.File,
+			constants.JobStatus["queued"],
+			jobErr.Error(),
+			runAt,
+			job.ID,
+			constants.JobStatus["running"],
+			job.Attempts,
+		)
+		if err != nil {
+			return err
+		}
+		if rowsNo, _ := result.RowsAffected(); rowsNo > 0 {
+			return nil
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rawQuery := `
+		UPDATE jobs
+		SET status = $1, last_error = $2, locked_at = NULL, updated_at = now()
+		WHERE id = $3 AND status = $4 AND attempts = $5
+	`
+	result, err := tx.Exec(
+		rawQuery,
+		constants.JobStatus["failed"],
+		jobErr.Error(),
+		job.ID,
+		constants.JobStatus["running"],
+		job.Attempts,
+	)
+	if err != nil {
+		return err
+	}
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return nil
+	}
+
+	rawQuery = `UPDATE files SET status = $3, updated_at = now() WHERE id = $1 AND NOT ` + queued
+	if _, err := tx.Exec(rawQuery, job.File, constants.JobStatus["queued"], constants.FileStatus["failed"]); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// finishJob marks the job as done in the transaction which saves its result. It returns
+// errJobTakenOver when another worker claimed the job since, the result is then discarded
+func finishJob(job model.Job, tx *sql.Tx) error {
+	rawQuery := `
+		UPDATE jobs
+		SET status = $1, last_error = NULL, locked_at = NULL, updated_at = now()
+		WHERE id = $2 AND status = $3 AND attempts = $4
+	`
+	result, err := tx.Exec(rawQuery, constants.JobStatus["done"], job.ID, constants.JobStatus["running"], job.Attempts)
+	if err != nil {
+		return err
+	}
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return errJobTakenOver
+	}
+
+	return nil
+}
+
+// extractMetadata reads metadata of the content. The type sniffed on upload is kept,
+// it tells apart RAW formats which look like TIFF
+func extractMetadata(data []byte, file model.File) model.File {
+	info, err := image.ExtractExif(data)
+	if err != nil {
+		log.Warn().Err(err).Caller().Int64("file", file.ID.Int64).Msg("Can't read EXIF")
+	}
+
+	info.MimeType = file.MimeType
+	info.Extension = file.Extension
+
+	return info
+}
+
+// processImage reads metadata of the image and creates its renditions rotated and edited by
+// the user. Dimensions are the displayed ones. Renditions stored for the same content rotated
+// and edited the same by another file are reused
+func processImage(file model.File, store storage.Storage, db *sql.DB) (model.File, []model.Rendition, error) {
+	f, err := store.Get(file.Hash.String)
+	if err != nil {
+		return file, nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return file, nil, err
+	}
+
+	info := extractMetadata(data, file)
+	rotation := file.Rotation.Int64
+	if image.SwapsSides(0, rotation) {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	if len(file.Edits) > 0 && info.Width.Valid && info.Height.Valid {
+		width, height := image.EditedDimensions(info.Width.Int64, info.Height.Int64, file.Edits)
+		info.Width, info.Height = null.IntFrom(width), null.IntFrom(height)
+	}
+
+	renditions, err := getBlobRenditions(file.Hash.String, rotation, file.Edits, db)
+	if err != nil || len(renditions) > 0 {
+		return info, renditions, err
+	}
+
+	renditions, err = createRenditions(data, file.Hash.String, rotation, file.Edits, store)
+
+	return info, renditions, err
+}
+
+// namePlace reverse geocodes where the file was taken. A failure leaves the place unknown
+// instead of failing the processing, it's named again by NameMissingPlaces
+func namePlace(info model.File, fileID int64) null.String {
+	place, err := geocode.Reverse(info.Latitude.Float64, info.Longitude.Float64)
+	if err != nil {
+		log.Warn().Err(err).Caller().Int64("file", fileID).Msg("Can't name the place")
+	}
+
+	return null.NewString(place, place != "")
+}
+
+// NameMissingPlaces names places of files with a location but without a place, the next files
+// after the one in the order of ids up to the limit. It returns the last visited file and how
+// many places were named. A failure of the service stops it at the file which failed
+func NameMissingPlaces(afterID int64, limit int, db *sql.DB) (int64, int, error) {
+	rawQuery := `
+		SELECT id, latitude, longitude
+		FROM files
+		WHERE
+			id > $1
+			AND latitude IS NOT NULL
+			AND longitude IS NOT NULL
+			AND place IS NULL
+			AND status = $2
+			AND trashed_at IS NULL
+		ORDER BY id
+		LIMIT $3
+	`
+	rows, err := db.Query(rawQuery, afterID, constants.FileStatus["ready"], limit)
+	if err != nil {
+		return afterID, 0, err
+	}
+
+	type location struct {
+		id        int64
+		latitude  float64
+		longitude float64
+	}
+	locations := []location{}
+	for rows.Next() {
+		l := location{}
+		if err := rows.Scan(&l.id, &l.latitude, &l.longitude); err != nil {
+			rows.Close()
+
+			return afterID, 0, err
+		}
+		locations = append(locations, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return afterID, 0, err
+	}
+
+	named := 0
+	last := afterID
+	for _, l := range locations {
+		place, err := geocode.Reverse(l.latitude, l.longitude)
+		if err != nil {
+			return last, named, err
+		}
+
+		// The file could be processed again or moved meanwhile
+		if place != "" {
+			rawQuery := `
+				UPDATE files SET place = $1, updated_at = now()
+				WHERE id = $2 AND place IS NULL AND latitude = $3 AND longitude = $4
+			`
+			if _, err := db.Exec(rawQuery, place, l.id, l.latitude, l.longitude); err != nil {
+				return last, named, err
+			}
+			named++
+		}
+		last = l.id
+	}
+
+	return last, named, nil
+}
+
+// processFile creates renditions of the file and fills its metadata. The file becomes
+// ready and the job done in one transaction. Renditions of a rotation or edits which
+// changed meanwhile aren't saved, nor is a result of a job taken over by another worker
+func processFile(job model.Job, store storage.Storage, db *sql.DB) error {
+	file, err := getFileByID(job.File, db)
+	if err != nil {
+		return err
+	}
+
+	var info model.File
+	var renditions []model.Rendition
+	if file.Type.String == constants.FileType["video"] {
+		info, renditions, err = processVideo(file, store, db)
+	} else {
+		info, renditions, err = processImage(file, store, db)
+	}
+	if err != nil {
+		return err
+	}
+
+	info.Place = file.Place
+	if !info.Place.Valid && info.Latitude.Valid && info.Longitude.Valid {
+		info.Place = namePlace(info, file.ID.Int64)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The file could be rotated or edited while it was rendered, then its newer job
+	// renders it again and this result is discarded
+	var current bool
+	rawQuery := `SELECT rotation = $2 AND edits = $3::jsonb FROM files WHERE id = $1 FOR UPDATE`
+	err = tx.QueryRow(rawQuery, job.File, file.Rotation.Int64, encodeEdits(file.Edits)).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if !current {
+		if err := finishJob(job, tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	rawQuery = `
+		UPDATE files
+		SET
+			extension = $1,
+			mime = $2,
+			latitude = $3,
+			longitude = $4,
+			orientation = $5,
+			model = $6,
+			camera = $7,
+			iso = $8,
+			focal_length = $9,
+			exposure_time = $10,
+			f_number = $11,
+			height = $12,
+			width = $13,
+			date = $14,
+			duration = $15,
+			codec = $16,
+			lens_make = $17,
+			lens_model = $18,
+			flash = $19,
+			white_balance = $20,
+			metering_mode = $21,
+			exposure_bias = $22,
+			software = $23,
+			copyright = $24,
+			title = $25,
+			caption = $26,
+			keywords = $27,
+			rating = $28,
+			place = $29,
+			exif = $30,
+			status = $31,
+			updated_at = now()
+		WHERE id = $32
+	`
+	_, err = tx.Exec(
+		rawQuery,
+		info.Extension,
+		info.MimeType,
+		info.Latitude,
+		info.Longitude,
+		info.Orientation,
+		info.Model,
+		info.Camera,
+		info.Iso,
+		info.FocalLength,
+		info.ExposureTime,
+		info.FNumber,
+		info.Height,
+		info.Width,
+		info.Date,
+		info.Duration,
+		info.Codec,
+		info.LensMake,
+		info.LensModel,
+		info.Flash,
+		info.WhiteBalance,
+		info.MeteringMode,
+		info.ExposureBias,
+		info.Software,
+		info.Copyright,
+		info.Title,
+		info.Caption,
+		pq.Array(info.Keywords),
+		info.Rating,
+		info.Place,
+		info.RawExif,
+		constants.FileStatus["ready"],
+		job.File,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRenditions(int64(job.File), file.Hash.String, renditions, store, tx); err != nil {
+		return err
+	}
+
+	if err := finishJob(job, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// safeProcessFile turns a panic of processing, e.g. in ImageMagick, into an error
+// so the worker survives and the job is retried
+func safeProcessFile(job model.Job, store storage.Storage, db *sql.DB) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("processing panicked: %v", r)
+		}
+	}()
+
+	return processFile(job, store, db)
+}
+
+// heartbeatJob refreshes the lock of the running job until the returned function is called
+func heartbeatJob(job model.Job, db *sql.DB) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+
+		rawQuery := `UPDATE jobs SET locked_at = now() WHERE id = $1 AND status = $2 AND attempts = $3`
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := db.Exec(rawQuery, job.ID, constants.JobStatus["running"], job.Attempts); err != nil {
+					log.Warn().Err(err).Caller().Int("job", job.ID).Msg("Can't refresh a job lock")
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// RunNextJob processes the next due job. It returns false when there was nothing to do.
+// A failed job is retried with an exponential backoff
+func RunNextJob(store storage.Storage, db *sql.DB) (bool, error) {
+	job, ok, err := claimJob(db)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	// Only a takeover claims a job after its last attempt
+	if job.Attempts > jobMaxAttempts {
+		log.Error().Caller().Int("job", job.ID).Int("file", job.File).Msg("Processing of a file timed out")
+
+		return true, failJob(job, errJobTimedOut, db)
+	}
+
+	stopHeartbeat := heartbeatJob(job, db)
+	err = safeProcessFile(job, store, db)
+	stopHeartbeat()
+	if err == errJobTakenOver {
+		log.Warn().Caller().Int("job", job.ID).Int("file", job.File).Msg("Processing took too long, result discarded")
+
+		return true, nil
+	}
+	if err != nil {
+		log.Error().
+			Err(err).
+			Caller().
+			Int("job", job.ID).
+			Int("file", job.File).
+			Int("attempts", job.Attempts).
+			Msg("Processing of a file failed")
+
+		return true, failJob(job, err, db)
+	}
+
+	return true, nil
+}
+
+// GetFileJob returns the latest processing job of the file. The file has to be viewable by the user
+func GetFileJob(fileID, userID int, db *sql.DB) (int, model.Job) {
+	job := model.Job{}
+	if status, _ := GetViewableFile(fileID, userID, db); status != http.StatusOK {
+		return status, job
+	}
+
+	rawQuery := `
+		SELECT id, file, status, attempts, last_error, run_at, updated_at
+		FROM jobs
+		WHERE file = $1
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	row := db.QueryRow(rawQuery, fileID)
+	err := row.Scan(&job.ID, &job.File, &job.Status, &job.Attempts, &job.LastError, &job.RunAt, &job.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, job
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch a job")
+
+		return http.StatusInternalServerError, job
+	}
+
+	return http.StatusOK, job
+}
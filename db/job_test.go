@@ -0,0 +1,158 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"photos/constants"
+	"photos/geocode"
+)
+
+func TestRetryDelay(t *testing.T) {
+	if delay := retryDelay(1); delay != jobRetryDelay {
+		t.Errorf("retryDelay = %s; want `%s`", delay, jobRetryDelay)
+	}
+
+	if delay := retryDelay(3); delay != 4*jobRetryDelay {
+		t.Errorf("retryDelay = %s; want `%s`", delay, 4*jobRetryDelay)
+	}
+
+	if delay := retryDelay(100); delay != jobMaxRetryDelay {
+		t.Errorf("retryDelay = %s; want `%s`, delay is capped", delay, jobMaxRetryDelay)
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	fileID := 3
+	tx, _ := db.Begin()
+	enqueueJob(int64(fileID), tx)
+	tx.Commit()
+
+	job, ok, err := claimJob(db)
+	if !ok || err != nil || job.File != fileID || job.Attempts != 1 {
+		t.Errorf("claimJob - file %d, expected %d - error: %s", job.File, fileID, err)
+	}
+
+	_, ok, _ = claimJob(db)
+	if ok {
+		t.Errorf("claimJob - running job can't be claimed twice")
+	}
+
+	failJob(job, errors.New("broken"), db)
+	status, failed := GetFileJob(fileID, 10, db)
+	if status != http.StatusOK || failed.Status != constants.JobStatus["queued"] || !failed.RunAt.After(time.Now()) {
+		t.Errorf("failJob - status %s, expected %s - retry is postponed", failed.Status, constants.JobStatus["queued"])
+	}
+
+	// The retry is claimed for the last time
+	job.Attempts = jobMaxAttempts
+	db.Exec(`UPDATE jobs SET status = $1, attempts = $2 WHERE id = $3`, constants.JobStatus["running"], job.Attempts, job.ID)
+	failJob(job, errors.New("broken"), db)
+	_, failed = GetFileJob(fileID, 10, db)
+	file, _ := getFileByID(fileID, db)
+	if failed.Status != constants.JobStatus["failed"] || file.Status.String != constants.FileStatus["failed"] {
+		t.Errorf("failJob - status %s, expected %s - no attempts left", failed.Status, constants.JobStatus["failed"])
+	}
+
+	status, _ = GetFileJob(fileID, 5, db)
+	if status != http.StatusNotFound {
+		t.Errorf("GetFileJob - status: %d, expected %d - file isn't viewable", status, http.StatusNotFound)
+	}
+}
+
+func TestEnqueueJob(t *testing.T) {
+	fileID := 4
+	for i := 0; i < 3; i++ {
+		tx, _ := db.Begin()
+		if err := enqueueJob(int64(fileID), tx); err != nil {
+			t.Errorf("enqueueJob - error: %s", err)
+		}
+		tx.Commit()
+	}
+	defer db.Exec(`DELETE FROM jobs WHERE file = $1`, fileID)
+
+	var count int
+	rawQuery := `SELECT count(*) FROM jobs WHERE file = $1 AND status = $2`
+	db.QueryRow(rawQuery, fileID, constants.JobStatus["queued"]).Scan(&count)
+	if count != 1 {
+		t.Errorf("enqueueJob = %d; want `%d` - queued jobs are coalesced", count, 1)
+	}
+}
+
+func TestFinishJobTakenOver(t *testing.T) {
+	fileID := 4
+	tx, _ := db.Begin()
+	enqueueJob(int64(fileID), tx)
+	tx.Commit()
+	defer db.Exec(`DELETE FROM jobs WHERE file = $1`, fileID)
+
+	job, ok, _ := claimJob(db)
+	if !ok || job.File != fileID {
+		t.Fatalf("claimJob - file %d, expected %d", job.File, fileID)
+	}
+
+	// The lock timed out and another worker claimed the job again
+	db.Exec(`UPDATE jobs SET attempts = attempts + 1 WHERE id = $1`, job.ID)
+
+	tx, _ = db.Begin()
+	defer tx.Rollback()
+	if err := finishJob(job, tx); err != errJobTakenOver {
+		t.Errorf("finishJob - error: %v, expected %v", err, errJobTakenOver)
+	}
+
+	failJob(job, errors.New("broken"), db)
+	_, current := GetFileJob(fileID, 9, db)
+	if current.Status != constants.JobStatus["running"] {
+		t.Errorf("failJob - status %s, expected %s - job was taken over", current.Status, constants.JobStatus["running"])
+	}
+}
+
+func TestRunNextJobTimedOut(t *testing.T) {
+	fileID := 4
+	file, _ := getFileByID(fileID, db)
+	tx, _ := db.Begin()
+	enqueueJob(int64(fileID), tx)
+	tx.Commit()
+	defer db.Exec(`UPDATE files SET status = $1 WHERE id = $2`, file.Status, fileID)
+	defer db.Exec(`DELETE FROM jobs WHERE file = $1`, fileID)
+
+	// The last attempt stopped refreshing its lock
+	rawQuery := `
+		UPDATE jobs
+		SET status = $1, attempts = $2, locked_at = now() - interval '1 day', run_at = now() - interval '1 day'
+		WHERE file = $3
+	`
+	db.Exec(rawQuery, constants.JobStatus["running"], jobMaxAttempts, fileID)
+
+	if processed, err := RunNextJob(store, db); !processed || err != nil {
+		t.Fatalf("RunNextJob = %t; want `true` - error: %v", processed, err)
+	}
+	_, failed := GetFileJob(fileID, 9, db)
+	if failed.Status != constants.JobStatus["failed"] || failed.LastError.String != errJobTimedOut.Error() {
+		t.Errorf("RunNextJob - status %s, expected %s - a takeover is an attempt", failed.Status, constants.JobStatus["failed"])
+	}
+}
+
+func TestNameMissingPlaces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"address": {"city": "Lisbon", "country": "Portugal"}}`))
+	}))
+	defer server.Close()
+	geocode.Configure(server.URL, "", "")
+	defer geocode.Configure("", "", "")
+
+	fileID := 7
+	file, _ := getFileByID(fileID, db)
+	rawQuery := `UPDATE files SET latitude = $1, longitude = $2, place = $3, status = $4 WHERE id = $5`
+	defer db.Exec(rawQuery, file.Latitude, file.Longitude, file.Place, file.Status, fileID)
+	db.Exec(rawQuery, 38.7139, -9.1394, nil, constants.FileStatus["ready"], fileID)
+
+	last, named, err := NameMissingPlaces(int64(fileID-1), 1, db)
+	placed, _ := getFileByID(fileID, db)
+	if err != nil || last != int64(fileID) || named != 1 || placed.Place.String != "Lisbon, Portugal" {
+		t.Errorf("NameMissingPlaces = %d, %d, %q; want `%d, 1, Lisbon, Portugal` - error: %v", last, named, placed.Place.String, fileID, err)
+	}
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"fmt"
+
+	constants "photos/constants"
+)
+
+// parsePrivilege converts a privilege name to the level stored in `user_album` or
+// `user_file`. Owner can't be granted
+func parsePrivilege(privileges map[string]int, name string) (int, error) {
+	privilege, ok := privileges[name]
+	if !ok || name == "owner" {
+		return 0, fmt.Errorf(constants.STRINGS["invalidPrivilege"], name)
+	}
+
+	return privilege, nil
+}
+
+func getPrivilegeName(privileges map[string]int, privilege int) string {
+	for name, value := range privileges {
+		if value == privilege {
+			return name
+		}
+	}
+
+	return ""
+}
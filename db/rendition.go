@@ -0,0 +1,224 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"photos/image"
+	model "photos/model"
+	"photos/storage"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// renditionKey names a stored rendition. It starts with the hash of the original so
+// renditions are removed together with their blob
+func renditionKey(hash, name, extension string) string {
+	return fmt.Sprintf("%s_%s.%s", hash, name, extension)
+}
+
+// renditionPrefix starts keys of renditions of the content rotated and edited by the user.
+// Renditions which aren't rotated are prefixed by the bare hash, edited ones by a digest
+// of the rotation and the edit stack
+func renditionPrefix(hash string, rotation int64, edits []model.Edit) string {
+	if len(edits) > 0 {
+		digest := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", rotation, encodeEdits(edits))))
+
+		return fmt.Sprintf("%s_e%x", hash, digest[:8])
+	}
+	if rotation == 0 {
+		return hash
+	}
+
+	return fmt.Sprintf("%s_r%d", hash, rotation)
+}
+
+// createRenditions generates the configured rendition set of the image rotated and edited
+// by the user and puts it to the storage
+func createRenditions(
+	data []byte,
+	hash string,
+	rotation int64,
+	edits []model.Edit,
+	store storage.Storage,
+) ([]model.Rendition, error) {
+	renditions := []model.Rendition{}
+	rendered, err := image.ResizeImage(data, rotation, edits)
+	if err != nil {
+		return renditions, err
+	}
+
+	for _, r := range rendered {
+		key := renditionKey(renditionPrefix(hash, rotation, edits), r.Rendition.Name, r.Format.Extension)
+		size := int64(len(r.Data))
+		if err := store.Put(key, bytes.NewReader(r.Data), size, r.Format.MimeType); err != nil {
+			return renditions, err
+		}
+
+		renditions = append(renditions, model.Rendition{
+			Name:     r.Rendition.Name,
+			MimeType: r.Format.MimeType,
+			Width:    r.Width,
+			Height:   r.Height,
+			Size:     size,
+			Key:      key,
+		})
+	}
+
+	return renditions, nil
+}
+
+func renditionsScanner(rows *sql.Rows) ([]model.Rendition, error) {
+	renditions := []model.Rendition{}
+	for rows.Next() {
+		r := model.Rendition{}
+		err := rows.Scan(&r.Name, &r.MimeType, &r.Width, &r.Height, &r.Size, &r.Key)
+		if err != nil {
+			return renditions, err
+		}
+
+		renditions = append(renditions, r)
+	}
+
+	return renditions, rows.Err()
+}
+
+// getBlobRenditions returns renditions stored for the content by any file rotated and edited
+// the same. They are the same for every such file with the hash, so a duplicate upload reuses them
+func getBlobRenditions(hash string, rotation int64, edits []model.Edit, db *sql.DB) ([]model.Rendition, error) {
+	rawQuery := `
+		SELECT DISTINCT ON (renditions.name, renditions.mime)
+			renditions.name,
+			renditions.mime,
+			renditions.width,
+			renditions.height,
+			renditions.size,
+			renditions.key
+		FROM
+			renditions
+			JOIN files ON files.id = renditions.file
+		WHERE
+			files.hash = $1
+			AND files.rotation = $2
+			AND files.edits = $3::jsonb
+	`
+
+	rows, err := db.Query(rawQuery, hash, rotation, encodeEdits(edits))
+	if err != nil {
+		return []model.Rendition{}, err
+	}
+	defer rows.Close()
+
+	return renditionsScanner(rows)
+}
+
+// insertRenditions records renditions of the file
+func insertRenditions(fileID int64, renditions []model.Rendition, tx *sql.Tx) error {
+	rawQuery := `
+		INSERT INTO renditions (file, name, mime, width, height, size, key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	for _, r := range renditions {
+		_, err := tx.Exec(rawQuery, fileID, r.Name, r.MimeType, r.Width, r.Height, r.Size, r.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errRenditionsRemoved is returned when renditions which a file was going to record were
+// removed meanwhile as stale renditions of another file, the file is rendered again on a retry
+var errRenditionsRemoved = errors.New("renditions were removed meanwhile")
+
+// replaceRenditions records renditions of the file instead of its previous ones and removes
+// previous ones which no file references any more from the storage. Renditions of a content
+// are replaced one transaction at a time, so stored objects of the recorded ones are checked
+// to still exist. A stale rendition which fails to be removed is left for FindOrphanBlobs
+func replaceRenditions(fileID int64, hash string, renditions []model.Rendition, store storage.Storage, tx *sql.Tx) error {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, hash); err != nil {
+		return err
+	}
+
+	for _, r := range renditions {
+		if _, err := store.Stat(r.Key); err == storage.ErrNotExist {
+			return errRenditionsRemoved
+		} else if err != nil {
+			return err
+		}
+	}
+
+	previous := []string{}
+	rows, err := tx.Query(`DELETE FROM renditions WHERE file = $1 RETURNING key`, fileID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+
+			return err
+		}
+		previous = append(previous, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := insertRenditions(fileID, renditions, tx); err != nil {
+		return err
+	}
+
+	stale := []string{}
+	rows, err = tx.Query(`SELECT unnest($1::text[]) EXCEPT SELECT key FROM renditions`, pq.Array(previous))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+
+			return err
+		}
+		stale = append(stale, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range stale {
+		if err := store.Delete(key); err != nil {
+			log.Error().Err(err).Caller().Int64("file", fileID).Str("key", key).Msg("Can't remove a stale rendition")
+		}
+	}
+
+	return nil
+}
+
+// GetRenditions returns all formats of the file's rendition. Doesn't check access
+func GetRenditions(fileID int, name string, db *sql.DB) ([]model.Rendition, error) {
+	rawQuery := `
+		SELECT name, mime, width, height, size, key
+		FROM renditions
+		WHERE file = $1 AND name = $2
+		ORDER BY id
+	`
+
+	rows, err := db.Query(rawQuery, fileID, name)
+	if err != nil {
+		return []model.Rendition{}, err
+	}
+	defer rows.Close()
+
+	return renditionsScanner(rows)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	model "photos/model"
+	"photos/storage"
+)
+
+func TestGetRenditions(t *testing.T) {
+	file, _ := getFileByID(5, db)
+	hash := file.Hash.String
+	renditions := []model.Rendition{
+		{Name: "640", MimeType: "image/jpeg", Width: 640, Height: 480, Size: 10, Key: renditionKey(hash, "640", "jpg")},
+		{Name: "640", MimeType: "image/webp", Width: 640, Height: 480, Size: 8, Key: renditionKey(hash, "640", "webp")},
+		{Name: "thumb", MimeType: "image/jpeg", Width: 256, Height: 256, Size: 4, Key: renditionKey(hash, "thumb", "jpg")},
+	}
+
+	tx, _ := db.Begin()
+	err := insertRenditions(file.ID.Int64, renditions, tx)
+	tx.Commit()
+	if err != nil {
+		t.Errorf("insertRenditions - error: %s", err)
+	}
+
+	found, err := GetRenditions(int(file.ID.Int64), "640", db)
+	if err != nil || len(found) != 2 || found[1].Key != hash+"_640.webp" {
+		t.Errorf("GetRenditions = %d; want `%d`", len(found), 2)
+	}
+
+	found, err = getBlobRenditions(hash, 0, nil, db)
+	if err != nil || len(found) != 3 {
+		t.Errorf("getBlobRenditions = %d; want `%d`", len(found), 3)
+	}
+
+	found, err = getBlobRenditions(hash, 90, nil, db)
+	if err != nil || len(found) != 0 {
+		t.Errorf("getBlobRenditions = %d; want `%d` - renditions of a rotated file", len(found), 0)
+	}
+
+	edits := []model.Edit{{Operation: "filter", Filter: "mono"}}
+	found, err = getBlobRenditions(hash, 0, edits, db)
+	if err != nil || len(found) != 0 {
+		t.Errorf("getBlobRenditions = %d; want `%d` - renditions of an edited file", len(found), 0)
+	}
+}
+
+func TestReplaceRenditions(t *testing.T) {
+	file, _ := getFileByID(6, db)
+	hash := file.Hash.String
+	rows, _ := db.Query(`SELECT name, mime, width, height, size, key FROM renditions WHERE file = $1`, file.ID)
+	previous, _ := renditionsScanner(rows)
+	rows.Close()
+	defer func() {
+		tx, _ := db.Begin()
+		tx.Exec(`DELETE FROM renditions WHERE file = $1`, file.ID)
+		insertRenditions(file.ID.Int64, previous, tx)
+		tx.Commit()
+	}()
+
+	replace := func(key string) error {
+		tx, _ := db.Begin()
+		defer tx.Rollback()
+		rendition := model.Rendition{Name: "thumb", MimeType: "image/jpeg", Width: 256, Height: 256, Size: 4, Key: key}
+		if err := replaceRenditions(file.ID.Int64, hash, []model.Rendition{rendition}, store, tx); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	rotated := renditionKey(renditionPrefix(hash, 90, nil), "thumb", "jpg")
+	store.Put(rotated, strings.NewReader("thumb"), 5, "image/jpeg")
+	if err := replace(rotated); err != nil {
+		t.Fatalf("replaceRenditions - error: %s", err)
+	}
+
+	edited := renditionKey(renditionPrefix(hash, 90, []model.Edit{{Operation: "filter", Filter: "mono"}}), "thumb", "jpg")
+	store.Put(edited, strings.NewReader("thumb"), 5, "image/jpeg")
+	defer store.Delete(edited)
+	if err := replace(edited); err != nil {
+		t.Fatalf("replaceRenditions - error: %s", err)
+	}
+	if _, err := store.Stat(rotated); err != storage.ErrNotExist {
+		t.Errorf("replaceRenditions - the rendition of the previous rotation should be removed")
+	}
+
+	if err := replace(rotated); err != errRenditionsRemoved {
+		t.Errorf("replaceRenditions - error: %v, expected %v", err, errRenditionsRemoved)
+	}
+}
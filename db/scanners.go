@@ -2,49 +2,92 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	model "photos/model"
+	"strings"
+
+	"github.com/lib/pq"
 )
 
-func filesScanner(rows *sql.Rows) ([]model.File, error) {
-	var images []model.File
-	for rows.Next() {
-		image := model.File{}
-		err := rows.Scan(
-			&image.ID,
-			&image.Owner,
-			&image.Name,
-			&image.Hash,
-			&image.Size,
-			&image.Extension,
-			&image.MimeType,
-			&image.Latitude,
-			&image.Longitude,
-			&image.Orientation,
-			&image.Model,
-			&image.Camera,
-			&image.Iso,
-			&image.FocalLength,
-			&image.ExposureTime,
-			&image.FNumber,
-			&image.Height,
-			&image.Width,
-			&image.Date,
-		)
+// fileColumns lists columns of `files` in the order of fileFields. Raw EXIF is left out,
+// it's only stored for later use
+var fileColumns = []string{
+	"id",
+	"type",
+	"owner",
+	"name",
+	"hash",
+	"size",
+	"extension",
+	"mime",
+	"latitude",
+	"longitude",
+	"orientation",
+	"model",
+	"camera",
+	"iso",
+	"focal_length",
+	"exposure_time",
+	"f_number",
+	"height",
+	"width",
+	"date",
+	"trashed_at",
+	"status",
+	"duration",
+	"codec",
+	"lens_make",
+	"lens_model",
+	"flash",
+	"white_balance",
+	"metering_mode",
+	"exposure_bias",
+	"software",
+	"copyright",
+	"title",
+	"caption",
+	"keywords",
+	"rating",
+	"tags",
+	"place",
+	"rotation",
+	"edits",
+}
 
-		if err == nil {
-			images = append(images, image)
-		} else {
-			return images, err
-		}
+// jsonColumn scans a JSON column into the value. NULL leaves the value as it is
+type jsonColumn struct {
+	value interface{}
+}
+
+func (c jsonColumn) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, c.value)
+	case string:
+		return json.Unmarshal([]byte(data), c.value)
 	}
 
-	return images, nil
+	return fmt.Errorf("can't scan %T as JSON", src)
 }
 
-func fileScanner(row *sql.Row) (model.File, error) {
-	file := model.File{}
-	err := row.Scan(
+// selectFileColumns returns fileColumns qualified with the table name
+func selectFileColumns(table string) string {
+	columns := make([]string, len(fileColumns))
+	for i, column := range fileColumns {
+		columns[i] = table + "." + column
+	}
+
+	return strings.Join(columns, ",\n\t\t")
+}
+
+// fileFields returns pointers to fields of the file in the order of fileColumns
+func fileFields(file *model.File) []interface{} {
+	return []interface{}{
 		&file.ID,
+		&file.Type,
 		&file.Owner,
 		&file.Name,
 		&file.Hash,
@@ -63,7 +106,48 @@ func fileScanner(row *sql.Row) (model.File, error) {
 		&file.Height,
 		&file.Width,
 		&file.Date,
-	)
+		&file.TrashedAt,
+		&file.Status,
+		&file.Duration,
+		&file.Codec,
+		&file.LensMake,
+		&file.LensModel,
+		&file.Flash,
+		&file.WhiteBalance,
+		&file.MeteringMode,
+		&file.ExposureBias,
+		&file.Software,
+		&file.Copyright,
+		&file.Title,
+		&file.Caption,
+		pq.Array(&file.Keywords),
+		&file.Rating,
+		pq.Array(&file.Tags),
+		&file.Place,
+		&file.Rotation,
+		jsonColumn{&file.Edits},
+	}
+}
+
+func filesScanner(rows *sql.Rows) ([]model.File, error) {
+	var images []model.File
+	for rows.Next() {
+		image := model.File{}
+		err := rows.Scan(fileFields(&image)...)
+
+		if err == nil {
+			images = append(images, image)
+		} else {
+			return images, err
+		}
+	}
+
+	return images, nil
+}
+
+func fileScanner(row *sql.Row) (model.File, error) {
+	file := model.File{}
+	err := row.Scan(fileFields(&file)...)
 
 	return file, err
 }
@@ -91,40 +175,22 @@ func albumsScanner(rows *sql.Rows) ([]model.Album, error) {
 		album := model.Album{}
 		file := model.File{}
 
-		err := rows.Scan(
+		fields := []interface{}{
 			&album.ID,
 			&album.Owner,
 			&album.Name,
 			&album.Size,
 			&album.UpdatedAt,
 			&album.CreatedAt,
+		}
 
-			&file.ID,
-			&file.Owner,
-			&file.Name,
-			&file.Hash,
-			&file.Size,
-			&file.Extension,
-			&file.MimeType,
-			&file.Latitude,
-			&file.Longitude,
-			&file.Orientation,
-			&file.Model,
-			&file.Camera,
-			&file.Iso,
-			&file.FocalLength,
-			&file.ExposureTime,
-			&file.FNumber,
-			&file.Height,
-			&file.Width,
-			&file.Date,
-		)
+		err := rows.Scan(append(fields, fileFields(&file)...)...)
 
 		if err != nil {
 			return albums, err
 		}
 		if file.ID.Valid {
-			album.File = model.Cover{true, file}
+			album.File = model.Cover{Valid: true, File: file}
 		}
 
 		albums = append(albums, album)
@@ -137,34 +203,19 @@ func albumScanner(row *sql.Row) (model.Album, error) {
 	album := model.Album{}
 	file := model.File{}
 
-	err := row.Scan(
-		album.ID,
-		album.Owner,
-		album.Name,
-		album.Size,
-		album.UpdatedAt,
-		album.CreatedAt,
+	fields := []interface{}{
+		&album.ID,
+		&album.Owner,
+		&album.Name,
+		&album.Size,
+		&album.UpdatedAt,
+		&album.CreatedAt,
+	}
 
-		&file.ID,
-		&file.Owner,
-		&file.Name,
-		&file.Hash,
-		&file.Size,
-		&file.Extension,
-		&file.MimeType,
-		&file.Latitude,
-		&file.Longitude,
-		&file.Orientation,
-		&file.Model,
-		&file.Camera,
-		&file.Iso,
-		&file.FocalLength,
-		&file.ExposureTime,
-		&file.FNumber,
-		&file.Height,
-		&file.Width,
-		&file.Date,
-	)
+	err := row.Scan(append(fields, fileFields(&file)...)...)
+	if err == nil && file.ID.Valid {
+		album.File = model.Cover{Valid: true, File: file}
+	}
 
 	return album, err
 }
@@ -0,0 +1,414 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"photos/constants"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Page sizes of search results
+const (
+	searchDefaultLimit = 100
+	searchMaxLimit     = 500
+)
+
+// facetsLimit is how many cameras and lenses are listed at most
+const facetsLimit = 50
+
+// highlightedText is text of a file shown with matched words highlighted. HTML in it is escaped
+// as headlines mark the words with tags
+const highlightedText = `replace(replace(replace(
+	concat_ws(' · ', files.title, files.caption, array_to_string(files.tags || coalesce(files.keywords, '{}'), ', '), files.place, files.name),
+	'&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+// headlineOptions set how ts_headline highlights words and cuts text around them
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxFragments=2, FragmentDelimiter=" … "`
+
+// SearchFilters select files by their metadata. Empty filters are ignored, the others
+// must all hold or, with MatchAny, at least one of them. Ranges include their bounds
+// and either of them may be left out. Camera, model and lens are matched regardless
+// of case, name by a substring. Query is text searched in names, titles, captions, tags,
+// keywords and places of files and in names of albums they are in, in the language set by
+// ConfigureSearch. It must match along with the filters and orders files by relevance
+type SearchFilters struct {
+	From           null.Time
+	To             null.Time
+	Camera         string
+	Model          string
+	Lens           string
+	IsoMin         null.Int
+	IsoMax         null.Int
+	FNumberMin     null.Float
+	FNumberMax     null.Float
+	FocalLengthMin null.Float
+	FocalLengthMax null.Float
+	MimeType       string
+	Type           string
+	HasGPS         null.Bool
+	Name           string
+	Album          string
+	Query          string
+	MatchAny       bool
+	Cursor         string
+	Limit          int
+}
+
+// searchLanguage is the text search configuration files and albums are indexed in, queries
+// must be parsed in the same one to match
+const searchLanguage = `(SELECT language FROM search_config)`
+
+// searchQuery collects conditions of a search with their arguments. Text is the tsquery of a
+// searched text, if any
+type searchQuery struct {
+	conditions []string
+	args       []interface{}
+	text       string
+}
+
+// arg adds the argument and returns its placeholder
+func (q *searchQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *searchQuery) add(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// bound is a nullable bound of a range
+type bound interface {
+	IsZero() bool
+}
+
+// addRange adds a condition of the column being between the bounds which are set
+func (q *searchQuery) addRange(column string, min, max bound) {
+	bounds := []string{}
+	if !min.IsZero() {
+		bounds = append(bounds, column+" >= "+q.arg(min))
+	}
+	if !max.IsZero() {
+		bounds = append(bounds, column+" <= "+q.arg(max))
+	}
+	if len(bounds) > 0 {
+		q.add("(" + strings.Join(bounds, " AND ") + ")")
+	}
+}
+
+// likePattern matches the text anywhere, wildcards in it are taken literally
+func likePattern(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+
+	return "%" + escaped + "%"
+}
+
+// textMatch is a condition of the file matching the tsquery by its words or by a name of an
+// album it's in. Only albums the user has access to are searched, as hasAlbumAccess checks
+func textMatch(text, user string) string {
+	return `(
+		files.search @@ ` + text + `
+		OR files.id IN (
+			SELECT album_file.file
+			FROM album_file
+			JOIN albums ON albums.id = album_file.album
+			LEFT JOIN user_album ON user_album.album = albums.id AND user_album.user = ` + user + `
+			WHERE
+				albums.search @@ ` + text + `
+				AND (albums.owner = ` + user + ` OR user_album.user IS NOT NULL)
+		)
+	)`
+}
+
+// encodeOffsetCursor points after the number of files found by text. Relevance isn't unique
+// nor stable, so such results are paged by offset
+func encodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeOffsetCursor(cursor string) (int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimPrefix(string(decoded), "offset:")
+	if value == string(decoded) {
+		return 0, errors.New("cursor has no offset")
+	}
+	offset, err := strconv.Atoi(value)
+	if err == nil && offset < 0 {
+		err = errors.New("cursor has a negative offset")
+	}
+
+	return offset, err
+}
+
+// buildSearch turns the filters into a condition on `files`. Files the user can't see and
+// trashed files never match. It returns 404 when the user has no access to the album
+func buildSearch(userID int, filters SearchFilters, db *sql.DB) (int, *searchQuery, string, error) {
+	q := &searchQuery{}
+	user := q.arg(userID)
+
+	if filters.Album != "" && !hasAlbumAccess(userID, filters.Album, db) {
+		return http.StatusNotFound, q, "", errors.New(constants.STRINGS["noAccessToAlbum"])
+	}
+
+	q.addRange(takenAt, filters.From, filters.To)
+	if filters.Camera != "" {
+		q.add("lower(files.camera) = lower(" + q.arg(filters.Camera) + ")")
+	}
+	if filters.Model != "" {
+		q.add("lower(files.model) = lower(" + q.arg(filters.Model) + ")")
+	}
+	if filters.Lens != "" {
+		q.add("lower(files.lens_model) = lower(" + q.arg(filters.Lens) + ")")
+	}
+	q.addRange("files.iso", filters.IsoMin, filters.IsoMax)
+	q.addRange("files.f_number", filters.FNumberMin, filters.FNumberMax)
+	q.addRange("files.focal_length", filters.FocalLengthMin, filters.FocalLengthMax)
+	if filters.MimeType != "" {
+		q.add("files.mime = " + q.arg(filters.MimeType))
+	}
+	if filters.Type != "" {
+		q.add("files.type::text = " + q.arg(strings.ToUpper(filters.Type)))
+	}
+	if filters.HasGPS.Valid && filters.HasGPS.Bool {
+		q.add("(files.latitude IS NOT NULL AND files.longitude IS NOT NULL)")
+	}
+	if filters.HasGPS.Valid && !filters.HasGPS.Bool {
+		q.add("(files.latitude IS NULL OR files.longitude IS NULL)")
+	}
+	if filters.Name != "" {
+		q.add("files.name ILIKE " + q.arg(likePattern(filters.Name)))
+	}
+	if filters.Album != "" {
+		q.add("files.id IN (SELECT file FROM album_file WHERE album = " + q.arg(filters.Album) + ")")
+	}
+
+	where := "files.trashed_at IS NULL AND " + viewableFile(user)
+	if len(q.conditions) > 0 {
+		operator := " AND "
+		if filters.MatchAny {
+			operator = " OR "
+		}
+		where += " AND (" + strings.Join(q.conditions, operator) + ")"
+	}
+	if filters.Query != "" {
+		q.text = "websearch_to_tsquery(" + searchLanguage + ", " + q.arg(filters.Query) + ")"
+		where += " AND " + textMatch(q.text, user)
+	}
+
+	return http.StatusOK, q, where, nil
+}
+
+// ConfigureSearch sets the text search configuration, e.g. `english`, which stems words and
+// drops stop words of the language. An empty one is `simple`, which only lowercases words.
+// Files and albums are indexed again when it changes
+func ConfigureSearch(language string, db *sql.DB) error {
+	if language == "" {
+		language = "simple"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var changed bool
+	rawQuery := `SELECT language <> $1::regconfig FROM search_config FOR UPDATE`
+	if err := tx.QueryRow(rawQuery, language).Scan(&changed); err != nil {
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	if _, err := tx.Exec(`UPDATE search_config SET language = $1::regconfig`, language); err != nil {
+		return err
+	}
+	// Triggers of the names compute search vectors again
+	for _, rawQuery := range []string{`UPDATE files SET name = name`, `UPDATE albums SET name = name`} {
+		if _, err := tx.Exec(rawQuery); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SearchFiles returns a page of files which the user can see and which match the filters,
+// from the newest taken. Files found by text are ordered by relevance and highlighted
+func SearchFiles(userID int, filters SearchFilters, db *sql.DB) (int, model.SearchResult, error) {
+	result := model.SearchResult{Files: []model.File{}}
+	status, q, where, err := buildSearch(userID, filters, db)
+	if err != nil {
+		return status, result, err
+	}
+
+	offset := 0
+	if filters.Cursor != "" && q.text != "" {
+		offset, err = decodeOffsetCursor(filters.Cursor)
+		if err != nil {
+			return http.StatusBadRequest, result, errors.New(constants.STRINGS["cursorInvalid"])
+		}
+	}
+	if filters.Cursor != "" && q.text == "" {
+		after, afterID, err := decodeCursor(filters.Cursor)
+		if err != nil {
+			return http.StatusBadRequest, result, errors.New(constants.STRINGS["cursorInvalid"])
+		}
+		where += " AND (" + takenAt + ", files.id) < (" + q.arg(after) + ", " + q.arg(afterID) + ")"
+	}
+
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = searchDefaultLimit
+	}
+	if limit > searchMaxLimit {
+		limit = searchMaxLimit
+	}
+
+	columns := selectFileColumns("files") + ", " + takenAt
+	order := takenAt + " DESC, files.id DESC"
+	if q.text != "" {
+		rank := "ts_rank(coalesce(files.search, ''), " + q.text + ")"
+		columns += ", " + rank + ", ts_headline(" + highlightedText + ", " + q.text + ", " + q.arg(headlineOptions) + ")"
+		order = rank + " DESC, " + order
+	}
+
+	// One more file tells whether there is a next page
+	rawQuery := `
+		SELECT ` + columns + `
+		FROM files
+		WHERE ` + where + `
+		ORDER BY ` + order + `
+		LIMIT ` + q.arg(limit+1) + ` OFFSET ` + q.arg(offset)
+
+	rows, err := db.Query(rawQuery, q.args...)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't search files")
+
+		return http.StatusInternalServerError, result, err
+	}
+	defer rows.Close()
+
+	var taken time.Time
+	for rows.Next() {
+		if len(result.Files) == limit {
+			last := result.Files[len(result.Files)-1]
+			result.NextCursor = encodeCursor(taken, last.ID.Int64)
+			if q.text != "" {
+				result.NextCursor = encodeOffsetCursor(offset + limit)
+			}
+			break
+		}
+
+		file := model.File{}
+		highlight := model.SearchHighlight{}
+		fields := append(fileFields(&file), &taken)
+		if q.text != "" {
+			fields = append(fields, &highlight.Rank, &highlight.Headline)
+		}
+		if err := rows.Scan(fields...); err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse found files")
+
+			return http.StatusInternalServerError, result, err
+		}
+
+		result.Files = append(result.Files, file)
+		if q.text != "" {
+			highlight.File = file.ID.Int64
+			result.Highlights = append(result.Highlights, highlight)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't search files")
+
+		return http.StatusInternalServerError, result, err
+	}
+
+	return http.StatusOK, result, nil
+}
+
+// facets counts files matching the query by the values of the columns, the most used first
+func facets(columns []string, where string, q *searchQuery, db *sql.DB) ([][]string, []int, error) {
+	rawQuery := `
+		SELECT ` + strings.Join(columns, ", ") + `, count(*)
+		FROM files
+		WHERE ` + where + ` AND ` + columns[len(columns)-1] + ` IS NOT NULL
+		GROUP BY ` + strings.Join(columns, ", ") + `
+		ORDER BY count(*) DESC, ` + strings.Join(columns, ", ") + `
+		LIMIT ` + strconv.Itoa(facetsLimit)
+
+	rows, err := db.Query(rawQuery, q.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	values := [][]string{}
+	counts := []int{}
+	for rows.Next() {
+		row := make([]null.String, len(columns))
+		var count int
+		fields := []interface{}{}
+		for i := range row {
+			fields = append(fields, &row[i])
+		}
+		if err := rows.Scan(append(fields, &count)...); err != nil {
+			return nil, nil, err
+		}
+
+		value := make([]string, len(columns))
+		for i := range row {
+			value[i] = row[i].String
+		}
+		values = append(values, value)
+		counts = append(counts, count)
+	}
+
+	return values, counts, rows.Err()
+}
+
+// GetSearchFacets lists cameras and lenses of files matching the filters with counts of files
+// taken by them. The cursor and the limit are ignored
+func GetSearchFacets(userID int, filters SearchFilters, db *sql.DB) (int, model.SearchFacets, error) {
+	result := model.SearchFacets{Cameras: []model.Facet{}, Lenses: []model.Facet{}}
+	status, q, where, err := buildSearch(userID, filters, db)
+	if err != nil {
+		return status, result, err
+	}
+
+	cameras, counts, err := facets([]string{"files.camera", "files.model"}, where, q, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't count cameras")
+
+		return http.StatusInternalServerError, result, err
+	}
+	for i, camera := range cameras {
+		result.Cameras = append(result.Cameras, model.Facet{Camera: camera[0], Model: camera[1], Count: counts[i]})
+	}
+
+	lenses, counts, err := facets([]string{"files.lens_model"}, where, q, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't count lenses")
+
+		return http.StatusInternalServerError, result, err
+	}
+	for i, lens := range lenses {
+		result.Lenses = append(result.Lenses, model.Facet{Lens: lens[0], Count: counts[i]})
+	}
+
+	return http.StatusOK, result, nil
+}
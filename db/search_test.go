@@ -0,0 +1,146 @@
+package db
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestLikePattern(t *testing.T) {
+	if pattern := likePattern(`100%_a\b`); pattern != `%100\%\_a\\b%` {
+		t.Errorf("likePattern = %s; want `%s`", pattern, `%100\%\_a\\b%`)
+	}
+}
+
+func TestSearchFiles(t *testing.T) {
+	userID := 17
+	files, _ := GetFiles(userID, db)
+
+	status, all, err := SearchFiles(userID, SearchFilters{Limit: searchMaxLimit}, db)
+	if err != nil || status != http.StatusOK || len(all.Files) < len(files) {
+		t.Errorf("SearchFiles = %d; want at least `%d` - own files without filters", len(all.Files), len(files))
+	}
+
+	_, withGPS, _ := SearchFiles(userID, SearchFilters{HasGPS: null.BoolFrom(true), Limit: searchMaxLimit}, db)
+	_, withoutGPS, _ := SearchFiles(userID, SearchFilters{HasGPS: null.BoolFrom(false), Limit: searchMaxLimit}, db)
+	if len(withGPS.Files)+len(withoutGPS.Files) != len(all.Files) {
+		t.Errorf("SearchFiles = %d + %d; want `%d` - with and without GPS", len(withGPS.Files), len(withoutGPS.Files), len(all.Files))
+	}
+
+	either := SearchFilters{Camera: "no such camera", HasGPS: null.BoolFrom(true), MatchAny: true, Limit: searchMaxLimit}
+	if _, found, _ := SearchFiles(userID, either, db); len(found.Files) != len(withGPS.Files) {
+		t.Errorf("SearchFiles = %d; want `%d` - any filter matches", len(found.Files), len(withGPS.Files))
+	}
+
+	either.MatchAny = false
+	if _, found, _ := SearchFiles(userID, either, db); len(found.Files) != 0 {
+		t.Errorf("SearchFiles = %d; want `%d` - all filters match", len(found.Files), 0)
+	}
+
+	_, page, _ := SearchFiles(userID, SearchFilters{Limit: 1}, db)
+	if len(all.Files) > 1 && (len(page.Files) != 1 || page.NextCursor == "") {
+		t.Errorf("SearchFiles = %d; want `%d` with a cursor", len(page.Files), 1)
+	}
+	_, next, _ := SearchFiles(userID, SearchFilters{Limit: 1, Cursor: page.NextCursor}, db)
+	if len(all.Files) > 1 && (len(next.Files) != 1 || next.Files[0].ID == page.Files[0].ID) {
+		t.Errorf("SearchFiles - the next page repeats the file %d", page.Files[0].ID.Int64)
+	}
+}
+
+func TestSearchFilesAlbum(t *testing.T) {
+	if status, _, err := SearchFiles(17, SearchFilters{Album: "999999"}, db); status != http.StatusNotFound || err == nil {
+		t.Errorf("SearchFiles = %d; want `%d` - album without access", status, http.StatusNotFound)
+	}
+}
+
+func TestGetSearchFacets(t *testing.T) {
+	status, facets, err := GetSearchFacets(17, SearchFilters{}, db)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("GetSearchFacets = %d; want `%d`", status, http.StatusOK)
+	}
+
+	for i := 1; i < len(facets.Cameras); i++ {
+		if facets.Cameras[i].Count > facets.Cameras[i-1].Count {
+			t.Errorf("GetSearchFacets - cameras should be sorted by count")
+		}
+	}
+}
+
+func TestOffsetCursor(t *testing.T) {
+	if offset, err := decodeOffsetCursor(encodeOffsetCursor(200)); err != nil || offset != 200 {
+		t.Errorf("decodeOffsetCursor = %d, %v; want `%d`", offset, err, 200)
+	}
+
+	for _, cursor := range []string{encodeCursor(time.Now(), 1), encodeOffsetCursor(-1), "!"} {
+		if _, err := decodeOffsetCursor(cursor); err == nil {
+			t.Errorf("decodeOffsetCursor(%q) - want an error", cursor)
+		}
+	}
+}
+
+func TestSearchFilesText(t *testing.T) {
+	userID := 17
+	files, _ := GetFiles(userID, db)
+	if len(files) == 0 {
+		t.Skip("the user has no files")
+	}
+	fileID := int(files[0].ID.Int64)
+	defer SetFileTags(fileID, userID, files[0].Tags, db)
+
+	SetFileTags(fileID, userID, []string{"beach", "Lisbon"}, db)
+	status, found, err := SearchFiles(userID, SearchFilters{Query: "lisbon beach"}, db)
+	if err != nil || status != http.StatusOK || len(found.Files) == 0 || len(found.Highlights) != len(found.Files) {
+		t.Fatalf("SearchFiles = %d, %d files; want `%d` with highlighted files", status, len(found.Files), http.StatusOK)
+	}
+	tagged := false
+	for _, highlight := range found.Highlights {
+		if highlight.File == int64(fileID) {
+			tagged = strings.Contains(highlight.Headline, "<mark>")
+		}
+	}
+	if !tagged {
+		t.Errorf("SearchFiles - want the tagged file %d with a highlight", fileID)
+	}
+
+	_, none, _ := SearchFiles(userID, SearchFilters{Query: "lisbon -beach"}, db)
+	for _, file := range none.Files {
+		if file.ID.Int64 == int64(fileID) {
+			t.Errorf("SearchFiles - the file %d has an excluded word", fileID)
+		}
+	}
+
+	if _, other, _ := SearchFiles(999999, SearchFilters{Query: "lisbon beach"}, db); len(other.Files) != 0 {
+		t.Errorf("SearchFiles = %d; want `%d` - files of another user", len(other.Files), 0)
+	}
+}
+
+func TestConfigureSearch(t *testing.T) {
+	userID := 17
+	files, _ := GetFiles(userID, db)
+	if len(files) == 0 {
+		t.Skip("the user has no files")
+	}
+	fileID := int(files[0].ID.Int64)
+	defer SetFileTags(fileID, userID, files[0].Tags, db)
+	defer ConfigureSearch("", db)
+
+	SetFileTags(fileID, userID, []string{"beach"}, db)
+	if err := ConfigureSearch("english", db); err != nil {
+		t.Fatalf("ConfigureSearch = %v; want `<nil>`", err)
+	}
+	_, found, err := SearchFiles(userID, SearchFilters{Query: "beaches"}, db)
+	stemmed := false
+	for _, file := range found.Files {
+		stemmed = stemmed || file.ID.Int64 == int64(fileID)
+	}
+	if err != nil || !stemmed {
+		t.Errorf("SearchFiles - want the file %d tagged `beach` found by a plural", fileID)
+	}
+
+	if err := ConfigureSearch("no_such_language", db); err == nil {
+		t.Error("ConfigureSearch - want an error of an unknown configuration")
+	}
+}
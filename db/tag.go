@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"photos/constants"
+	model "photos/model"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// Limits of tags of a file
+const (
+	tagsMaxCount  = 50
+	tagsMaxLength = 64
+)
+
+// normalizeTags trims the tags and drops empty ones and repeated ones regardless of case,
+// the first spelling is kept
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > tagsMaxLength {
+			return nil, fmt.Errorf(constants.STRINGS["tagTooLong"], tagsMaxLength)
+		}
+
+		seen[strings.ToLower(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > tagsMaxCount {
+		return nil, fmt.Errorf(constants.STRINGS["tagsTooMany"], tagsMaxCount)
+	}
+
+	return normalized, nil
+}
+
+// SetFileTags replaces tags of the file, they are searched along with its name and caption.
+// Editors can tag
+func SetFileTags(fileID, userID int, tags []string, db *sql.DB) (int, model.File, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return http.StatusBadRequest, model.File{}, err
+	}
+
+	if !hasFilePrivilege(userID, fileID, constants.FilePrivilege["editor"], db) {
+		return http.StatusForbidden, model.File{}, nil
+	}
+
+	rawQuery := `UPDATE files SET tags = $1, updated_at = now() WHERE id = $2`
+	if _, err := db.Exec(rawQuery, pq.Array(tags), fileID); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't tag a file")
+
+		return http.StatusInternalServerError, model.File{}, err
+	}
+
+	file, err := getFileByID(fileID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Int("file", fileID).Msg("Can't fetch a file")
+
+		return http.StatusInternalServerError, file, err
+	}
+
+	return http.StatusOK, file, nil
+}
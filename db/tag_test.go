@@ -0,0 +1,48 @@
+package db
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" beach ", "Lisbon", "", "lisbon", "summer  trip"})
+	want := []string{"beach", "Lisbon", "summer trip"}
+	if err != nil || !reflect.DeepEqual(tags, want) {
+		t.Errorf("normalizeTags = %v, %v; want `%v`", tags, err, want)
+	}
+
+	if _, err := normalizeTags([]string{strings.Repeat("a", tagsMaxLength+1)}); err == nil {
+		t.Error("normalizeTags - want an error of a too long tag")
+	}
+
+	many := []string{}
+	for i := 0; i <= tagsMaxCount; i++ {
+		many = append(many, strings.Repeat("a", i+1))
+	}
+	if _, err := normalizeTags(many); err == nil {
+		t.Error("normalizeTags - want an error of too many tags")
+	}
+}
+
+func TestSetFileTags(t *testing.T) {
+	userID := 17
+	files, _ := GetFiles(userID, db)
+	if len(files) == 0 {
+		t.Skip("the user has no files")
+	}
+	fileID := int(files[0].ID.Int64)
+
+	status, file, err := SetFileTags(fileID, userID, []string{"beach", "Beach", "Lisbon"}, db)
+	if err != nil || status != http.StatusOK || len(file.Tags) != 2 {
+		t.Errorf("SetFileTags = %d, %v; want `%d` with 2 tags", status, file.Tags, http.StatusOK)
+	}
+
+	if status, _, _ := SetFileTags(fileID, 999999, []string{"beach"}, db); status != http.StatusForbidden {
+		t.Errorf("SetFileTags = %d; want `%d` - not an editor", status, http.StatusForbidden)
+	}
+
+	SetFileTags(fileID, userID, files[0].Tags, db)
+}
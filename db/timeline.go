@@ -0,0 +1,281 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"photos/constants"
+	model "photos/model"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Page sizes of the timeline
+const (
+	timelineDefaultLimit = 100
+	timelineMaxLimit     = 500
+)
+
+// takenAt orders the timeline. Files without the capture date are placed by their upload
+const takenAt = "coalesce(files.date, files.created_at)"
+
+// timelineGroup is how the timeline is split to buckets
+type timelineGroup struct {
+	unit   string // date_trunc unit
+	format string // to_char format of bucket keys
+}
+
+var timelineGroups = map[string]timelineGroup{
+	"day":   {"day", "YYYY-MM-DD"},
+	"month": {"month", "YYYY-MM"},
+}
+
+// TimelineOptions select a page of the timeline. Group is `day` or `month`, days and months
+// start in the time zone. An empty cursor starts at the newest file
+type TimelineOptions struct {
+	Group    string
+	TimeZone string
+	Cursor   string
+	Limit    int
+}
+
+// encodeCursor points after the file taken at the time, the id tells apart files taken
+// at the same time
+func encodeCursor(taken time.Time, fileID int64) string {
+	cursor := fmt.Sprintf("%d:%d", taken.UnixNano(), fileID)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 2 {
+		return time.Time{}, 0, errors.New("cursor has no file")
+	}
+
+	nanoseconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	fileID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	return time.Unix(0, nanoseconds), fileID, nil
+}
+
+// parseTimelineOptions checks the group and the time zone and sets defaults
+func parseTimelineOptions(options TimelineOptions) (timelineGroup, TimelineOptions, error) {
+	if options.Group == "" {
+		options.Group = "day"
+	}
+	group, ok := timelineGroups[options.Group]
+	if !ok {
+		return group, options, errors.New(constants.STRINGS["timelineGroupInvalid"])
+	}
+
+	if options.TimeZone == "" {
+		options.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(options.TimeZone); err != nil || strings.EqualFold(options.TimeZone, "local") {
+		return group, options, errors.New(constants.STRINGS["timeZoneInvalid"])
+	}
+
+	if options.Limit <= 0 {
+		options.Limit = timelineDefaultLimit
+	}
+	if options.Limit > timelineMaxLimit {
+		options.Limit = timelineMaxLimit
+	}
+
+	return group, options, nil
+}
+
+// countBuckets counts files of the user in buckets between the oldest and the newest time
+func countBuckets(
+	userID int,
+	group timelineGroup,
+	timeZone string,
+	oldest, newest time.Time,
+	db *sql.DB,
+) (map[string]int, error) {
+	rawQuery := `
+		SELECT to_char(` + takenAt + ` AT TIME ZONE $2, $3), count(*)
+		FROM files
+		WHERE
+			owner = $1
+			AND trashed_at IS NULL
+			AND ` + takenAt + ` >= date_trunc($4, $5::timestamptz AT TIME ZONE $2) AT TIME ZONE $2
+			AND ` + takenAt + ` < (date_trunc($4, $6::timestamptz AT TIME ZONE $2) + ('1 ' || $4)::interval) AT TIME ZONE $2
+		GROUP BY 1
+	`
+
+	rows, err := db.Query(rawQuery, userID, timeZone, group.format, group.unit, oldest, newest)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+
+		counts[key] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetTimeline returns a page of files of the user, except trashed ones, from the newest taken.
+// Files are grouped into days or months with counts of the whole buckets. A bucket may
+// continue on the next page
+func GetTimeline(userID int, options TimelineOptions, db *sql.DB) (int, model.Timeline, error) {
+	timeline := model.Timeline{Buckets: []model.TimelineBucket{}}
+	group, options, err := parseTimelineOptions(options)
+	if err != nil {
+		return http.StatusBadRequest, timeline, err
+	}
+
+	var after sql.NullTime
+	var afterID int64
+	if options.Cursor != "" {
+		after.Time, afterID, err = decodeCursor(options.Cursor)
+		if err != nil {
+			return http.StatusBadRequest, timeline, errors.New(constants.STRINGS["cursorInvalid"])
+		}
+		after.Valid = true
+	}
+
+	// One more file tells whether there is a next page
+	rawQuery := `
+		SELECT
+			` + selectFileColumns("files") + `,
+			` + takenAt + `,
+			to_char(` + takenAt + ` AT TIME ZONE $2, $3)
+		FROM files
+		WHERE
+			owner = $1
+			AND trashed_at IS NULL
+			AND ($4::timestamptz IS NULL OR (` + takenAt + `, files.id) < ($4, $5))
+		ORDER BY ` + takenAt + ` DESC, files.id DESC
+		LIMIT $6
+	`
+	rows, err := db.Query(rawQuery, userID, options.TimeZone, group.format, after, afterID, options.Limit+1)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch the timeline")
+
+		return http.StatusInternalServerError, timeline, err
+	}
+	defer rows.Close()
+
+	type timelineRow struct {
+		file  model.File
+		taken time.Time
+		key   string
+	}
+	timelineRows := []timelineRow{}
+	for rows.Next() {
+		row := timelineRow{}
+		if err := rows.Scan(append(fileFields(&row.file), &row.taken, &row.key)...); err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse the timeline")
+
+			return http.StatusInternalServerError, timeline, err
+		}
+
+		timelineRows = append(timelineRows, row)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch the timeline")
+
+		return http.StatusInternalServerError, timeline, err
+	}
+
+	if len(timelineRows) == 0 {
+		return http.StatusOK, timeline, nil
+	}
+	if len(timelineRows) > options.Limit {
+		timelineRows = timelineRows[:options.Limit]
+		last := timelineRows[len(timelineRows)-1]
+		timeline.NextCursor = encodeCursor(last.taken, last.file.ID.Int64)
+	}
+
+	for _, row := range timelineRows {
+		if len(timeline.Buckets) == 0 || timeline.Buckets[len(timeline.Buckets)-1].Key != row.key {
+			timeline.Buckets = append(timeline.Buckets, model.TimelineBucket{Key: row.key, Files: []model.File{}})
+		}
+		bucket := &timeline.Buckets[len(timeline.Buckets)-1]
+		bucket.Files = append(bucket.Files, row.file)
+	}
+
+	newest, oldest := timelineRows[0].taken, timelineRows[len(timelineRows)-1].taken
+	counts, err := countBuckets(userID, group, options.TimeZone, oldest, newest, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't count the timeline")
+
+		return http.StatusInternalServerError, timeline, err
+	}
+	for i := range timeline.Buckets {
+		timeline.Buckets[i].Count = counts[timeline.Buckets[i].Key]
+	}
+
+	return http.StatusOK, timeline, nil
+}
+
+// GetTimelineBuckets returns all buckets of the timeline with counts of their files, from
+// the newest. It's enough to build a scrubber without fetching files
+func GetTimelineBuckets(userID int, options TimelineOptions, db *sql.DB) (int, []model.TimelineBucket, error) {
+	buckets := []model.TimelineBucket{}
+	group, options, err := parseTimelineOptions(options)
+	if err != nil {
+		return http.StatusBadRequest, buckets, err
+	}
+
+	rawQuery := `
+		SELECT to_char(` + takenAt + ` AT TIME ZONE $2, $3), count(*)
+		FROM files
+		WHERE owner = $1 AND trashed_at IS NULL
+		GROUP BY 1
+		ORDER BY 1 DESC
+	`
+	rows, err := db.Query(rawQuery, userID, options.TimeZone, group.format)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch timeline buckets")
+
+		return http.StatusInternalServerError, buckets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		bucket := model.TimelineBucket{}
+		if err := rows.Scan(&bucket.Key, &bucket.Count); err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse timeline buckets")
+
+			return http.StatusInternalServerError, buckets, err
+		}
+
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch timeline buckets")
+
+		return http.StatusInternalServerError, buckets, err
+	}
+
+	return http.StatusOK, buckets, nil
+}
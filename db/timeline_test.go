@@ -0,0 +1,77 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTimelineCursor(t *testing.T) {
+	taken := time.Date(2021, 5, 3, 10, 20, 30, 123456000, time.UTC)
+	decoded, fileID, err := decodeCursor(encodeCursor(taken, 42))
+	if err != nil || !decoded.Equal(taken) || fileID != 42 {
+		t.Errorf("decodeCursor = %s, %d; want `%s, %d`", decoded, fileID, taken, 42)
+	}
+
+	if _, _, err := decodeCursor("not a cursor"); err == nil {
+		t.Errorf("decodeCursor - invalid cursor, expected an error")
+	}
+}
+
+func TestGetTimeline(t *testing.T) {
+	userID := 17
+	files, _ := GetFiles(userID, db)
+
+	seen := map[int64]bool{}
+	options := TimelineOptions{Group: "month", Limit: 10}
+	for pages := 0; pages <= len(files); pages++ {
+		status, timeline, err := GetTimeline(userID, options, db)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("GetTimeline = %d; want `%d` - error: %v", status, http.StatusOK, err)
+		}
+
+		for _, bucket := range timeline.Buckets {
+			if bucket.Count < len(bucket.Files) {
+				t.Errorf("GetTimeline - bucket %s counts %d of %d files", bucket.Key, bucket.Count, len(bucket.Files))
+			}
+			for _, file := range bucket.Files {
+				if seen[file.ID.Int64] {
+					t.Errorf("GetTimeline - file %d is on more pages", file.ID.Int64)
+				}
+				seen[file.ID.Int64] = true
+			}
+		}
+
+		if timeline.NextCursor == "" {
+			break
+		}
+		options.Cursor = timeline.NextCursor
+	}
+
+	if len(seen) != len(files) {
+		t.Errorf("GetTimeline = %d; want `%d` files on all pages", len(seen), len(files))
+	}
+
+	status, buckets, err := GetTimelineBuckets(userID, TimelineOptions{Group: "month"}, db)
+	total := 0
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+	if err != nil || status != http.StatusOK || total != len(files) {
+		t.Errorf("GetTimelineBuckets = %d; want `%d` files in buckets", total, len(files))
+	}
+}
+
+func TestGetTimelineInvalid(t *testing.T) {
+	if status, _, err := GetTimeline(17, TimelineOptions{Group: "week"}, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("GetTimeline = %d; want `%d` - unknown group", status, http.StatusBadRequest)
+	}
+
+	if status, _, err := GetTimeline(17, TimelineOptions{TimeZone: "Mars/Olympus"}, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("GetTimeline = %d; want `%d` - unknown time zone", status, http.StatusBadRequest)
+	}
+
+	if status, _, err := GetTimeline(17, TimelineOptions{Cursor: "bm90IGEgY3Vyc29y"}, db); status != http.StatusBadRequest || err == nil {
+		t.Errorf("GetTimeline = %d; want `%d` - invalid cursor", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	constants "photos/constants"
+	model "photos/model"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// apiTokenPrefix distinguishes API tokens from session tokens
+const apiTokenPrefix = "pht_"
+
+func isGrantableScope(scope string) bool {
+	if scope == constants.Scope["account"] {
+		return false
+	}
+
+	for _, value := range constants.Scope {
+		if value == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, value := range scopes {
+		if value == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateAPIToken creates a long-lived token with given scopes. The token is returned
+// only here, db keeps its hash
+func CreateAPIToken(userID int, name string, scopes []string, db *sql.DB) (int, model.APIToken, error) {
+	if name == "" {
+		return http.StatusBadRequest, model.APIToken{}, errors.New(constants.STRINGS["noTokenName"])
+	}
+
+	for _, scope := range scopes {
+		if !isGrantableScope(scope) {
+			return http.StatusBadRequest,
+				model.APIToken{},
+				fmt.Errorf(constants.STRINGS["invalidScope"], scope)
+		}
+	}
+
+	token, hash, err := createToken()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate a token")
+
+		return http.StatusInternalServerError, model.APIToken{}, err
+	}
+
+	apiToken := model.APIToken{Name: name, Scopes: scopes, Token: apiTokenPrefix + token}
+	if apiToken.Scopes == nil {
+		apiToken.Scopes = []string{}
+	}
+
+	query := `
+		INSERT INTO api_tokens("user", name, token, scopes)
+		VALUES($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	row := db.QueryRow(query, userID, name, hash, pq.Array(apiToken.Scopes))
+	err = row.Scan(&apiToken.ID, &apiToken.CreatedAt)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't create a token")
+
+		return http.StatusInternalServerError, model.APIToken{}, err
+	}
+
+	return http.StatusCreated, apiToken, nil
+}
+
+// GetAPITokens returns all tokens of a user without their values
+func GetAPITokens(userID int, db *sql.DB) ([]model.APIToken, error) {
+	tokens := []model.APIToken{}
+	query := `
+		SELECT id, name, scopes, last_used_at, created_at
+		FROM api_tokens
+		WHERE "user" = $1
+		ORDER BY created_at
+	`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token := model.APIToken{}
+		err := rows.Scan(
+			&token.ID,
+			&token.Name,
+			pq.Array(&token.Scopes),
+			&token.LastUsedAt,
+			&token.CreatedAt,
+		)
+
+		if err != nil {
+			return tokens, err
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken removes a token owned by the user
+func RevokeAPIToken(tokenID string, userID int, db *sql.DB) int {
+	query := `DELETE FROM api_tokens WHERE id = $1 AND "user" = $2`
+	result, err := db.Exec(query, tokenID, userID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("token", tokenID).Msg("Can't revoke a token")
+
+		return http.StatusInternalServerError
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound
+	}
+
+	return http.StatusOK
+}
+
+func getAPITokenUser(token, scope string, db *sql.DB) (int, int, error) {
+	var userID int
+	var scopes []string
+
+	query := `
+		UPDATE api_tokens SET last_used_at = now()
+		WHERE token = $1
+		RETURNING "user", scopes
+	`
+	row := db.QueryRow(query, hashToken(strings.TrimPrefix(token, apiTokenPrefix)))
+	err := row.Scan(&userID, pq.Array(&scopes))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Caller().Msg("Can't fetch a token")
+		}
+
+		return 0, http.StatusUnauthorized, errors.New(constants.STRINGS["unauthorized"])
+	}
+
+	if scope != "" && !hasScope(scopes, scope) {
+		return userID, http.StatusForbidden, errors.New(constants.STRINGS["insufficientScope"])
+	}
+
+	return userID, http.StatusOK, nil
+}
+
+// Authenticate resolves the owner of a session or an API token. Sessions are allowed
+// to do everything, API tokens need the scope. Pass an empty scope when any valid
+// credential is enough
+func Authenticate(token, scope string, db *sql.DB) (int, int, error) {
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return getAPITokenUser(token, scope, db)
+	}
+
+	userID, err := GetSessionUser(token, db)
+	if err != nil {
+		return 0, http.StatusUnauthorized, err
+	}
+
+	return userID, http.StatusOK, nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	constants "photos/constants"
+)
+
+func TestCreateAPIToken(t *testing.T) {
+	userID := 3
+	scopes := []string{constants.Scope["readFiles"]}
+
+	status, token, err := CreateAPIToken(userID, "sync", scopes, db)
+	if status != http.StatusCreated || err != nil || token.Token == "" {
+		t.Errorf("CreateAPIToken - status: %d, expected %d - error: %s", status, http.StatusCreated, err)
+	}
+
+	status, _, _ = CreateAPIToken(userID, "admin", []string{constants.Scope["account"]}, db)
+	if status != http.StatusBadRequest {
+		t.Errorf("CreateAPIToken - status: %d, expected %d - account scope", status, http.StatusBadRequest)
+	}
+
+	tokens, err := GetAPITokens(userID, db)
+	if err != nil || len(tokens) != 1 || tokens[0].Token != "" {
+		t.Errorf("GetAPITokens - %d, expected %d - value must not be returned", len(tokens), 1)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	userID := 4
+	scopes := []string{constants.Scope["readFiles"], constants.Scope["upload"]}
+	_, token, _ := CreateAPIToken(userID, "script", scopes, db)
+
+	authUser, status, _ := Authenticate(token.Token, constants.Scope["upload"], db)
+	if authUser != userID || status != http.StatusOK {
+		t.Errorf("Authenticate - user %d, status %d - token with the scope", authUser, status)
+	}
+
+	_, status, _ = Authenticate(token.Token, constants.Scope["delete"], db)
+	if status != http.StatusForbidden {
+		t.Errorf("Authenticate - status %d, expected %d - token without the scope", status, http.StatusForbidden)
+	}
+
+	tokens, _ := GetAPITokens(userID, db)
+	if len(tokens) != 1 || !tokens[0].LastUsedAt.Valid {
+		t.Errorf("Authenticate - last used timestamp should be set")
+	}
+
+	status = RevokeAPIToken(fmt.Sprintf("%d", token.ID), 5, db)
+	if status != http.StatusNotFound {
+		t.Errorf("RevokeAPIToken - status %d, expected %d - not an owner", status, http.StatusNotFound)
+	}
+
+	status = RevokeAPIToken(fmt.Sprintf("%d", token.ID), userID, db)
+	_, authStatus, _ := Authenticate(token.Token, "", db)
+	if status != http.StatusOK || authStatus != http.StatusUnauthorized {
+		t.Errorf("RevokeAPIToken - status %d, auth status %d - revoked token", status, authStatus)
+	}
+}
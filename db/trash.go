@@ -0,0 +1,160 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	constants "photos/constants"
+	model "photos/model"
+	"photos/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GetTrash returns trashed files of the user, the most recently trashed first
+func GetTrash(userID int, db *sql.DB) ([]model.File, error) {
+	query := selectFile + " WHERE owner = $1 AND trashed_at IS NOT NULL ORDER BY trashed_at DESC"
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return []model.File{}, err
+	}
+	defer rows.Close()
+
+	return filesScanner(rows)
+}
+
+// RestoreFiles takes files of the user out of the trash. Albums and shares were never
+// touched by trashing, so the files show up there again. Returning id of not restored files.
+func RestoreFiles(filesID []int, userID int, db *sql.DB) []int {
+	var notRestored []int
+
+	for _, file := range filesID {
+		rawQuery := `UPDATE files SET trashed_at = NULL WHERE id = $1 AND owner = $2 AND trashed_at IS NOT NULL`
+		result, err := db.Exec(rawQuery, file, userID)
+		if err != nil {
+			notRestored = append(notRestored, file)
+
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", file).Msg("Problem with restoring a file")
+			continue
+		}
+
+		if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+			notRestored = append(notRestored, file)
+		}
+	}
+
+	return notRestored
+}
+
+// purgeFile permanently deletes the file. Rows go first, blobs are removed from the storage
+// after the commit and only when no other file references them. A blob which fails to be
+// removed stays as an orphan without any row and is cleaned up by FindOrphanBlobs, never
+// the other way around. For deleting related entries in `album_file`, `user_file`, etc. db takes care.
+func purgeFile(fileID int, store storage.Storage, db *sql.DB) error {
+	hash, last, err := deleteFile(fileID, db)
+	if err != nil {
+		return err
+	}
+
+	if last {
+		if err := removeBlob(hash, store); err != nil {
+			log.Error().
+				Err(err).
+				Caller().
+				Int("file", fileID).
+				Str("hash", hash).
+				Msg("Can't remove a blob, it is left for reconciliation")
+		}
+	}
+
+	return nil
+}
+
+// PurgeFiles permanently deletes trashed files of the user. Returning id of not deleted files.
+func PurgeFiles(filesID []int, userID int, store storage.Storage, db *sql.DB) []int {
+	var notDeleted []int
+
+	for _, file := range filesID {
+		var trashed bool
+		rawQuery := `SELECT trashed_at IS NOT NULL FROM files WHERE id = $1`
+		err := db.QueryRow(rawQuery, file).Scan(&trashed)
+
+		if err != nil || !trashed || !hasFilePrivilege(userID, file, constants.FilePrivilege["owner"], db) {
+			notDeleted = append(notDeleted, file)
+
+			log.Warn().Caller().Int("user", userID).Int("file", file).Msg("Problem with purging a file")
+			continue
+		}
+
+		if err := purgeFile(file, store, db); err != nil {
+			notDeleted = append(notDeleted, file)
+
+			log.Error().Err(err).Caller().Int("user", userID).Int("file", file).Msg("Problem with purging a file")
+		}
+	}
+
+	return notDeleted
+}
+
+// trashedFiles returns id of files trashed before the given time. Zero userID means all users
+func trashedFiles(userID int, before time.Time, db *sql.DB) ([]int, error) {
+	ids := []int{}
+	rawQuery := `
+		SELECT id
+		FROM files
+		WHERE
+			trashed_at IS NOT NULL
+			AND trashed_at < $1
+			AND ($2 = 0 OR owner = $2)
+	`
+
+	rows, err := db.Query(rawQuery, before, userID)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// EmptyTrash permanently deletes all trashed files of the user. Returning id of not deleted files.
+func EmptyTrash(userID int, store storage.Storage, db *sql.DB) ([]int, error) {
+	files, err := trashedFiles(userID, time.Now(), db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch the trash")
+
+		return []int{}, err
+	}
+
+	return PurgeFiles(files, userID, store, db), nil
+}
+
+// PurgeExpiredTrash permanently deletes files which have been in the trash longer than
+// the retention. Returns the number of deleted files.
+func PurgeExpiredTrash(retention time.Duration, store storage.Storage, db *sql.DB) (int, error) {
+	files, err := trashedFiles(0, time.Now().Add(-retention), db)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, file := range files {
+		if err := purgeFile(file, store, db); err != nil {
+			log.Error().Err(err).Caller().Int("file", file).Msg("Problem with purging an expired file")
+			continue
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
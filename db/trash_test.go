@@ -0,0 +1,86 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func containsFile(files []int, fileID int) bool {
+	for _, file := range files {
+		if file == fileID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func albumFileIDs(albumID string) []int {
+	ids := []int{}
+	files, _ := getAlbumFiles(albumID, db)
+	for _, file := range files {
+		ids = append(ids, int(file.ID.Int64))
+	}
+
+	return ids
+}
+
+func TestRestoreFiles(t *testing.T) {
+	userID := 19
+	fileID := 825
+	albumID := "99"
+
+	DeleteFiles([]int{fileID}, userID, db)
+	trash, err := GetTrash(userID, db)
+	if err != nil || len(trash) != 1 || !trash[0].TrashedAt.Valid {
+		t.Errorf("GetTrash = %d; want `%d`", len(trash), 1)
+	}
+
+	if containsFile(albumFileIDs(albumID), fileID) {
+		t.Errorf("getAlbumFiles - trashed file is hidden")
+	}
+
+	notRestored := RestoreFiles([]int{fileID}, userID+1, db)
+	if len(notRestored) != 1 {
+		t.Errorf("RestoreFiles - %d, expected %d - user isn't the owner", len(notRestored), 1)
+	}
+
+	notRestored = RestoreFiles([]int{fileID}, userID, db)
+	trash, _ = GetTrash(userID, db)
+	if len(notRestored) != 0 || len(trash) != 0 || !containsFile(albumFileIDs(albumID), fileID) {
+		t.Errorf("RestoreFiles - %d, expected %d - file is back in the album", len(notRestored), 0)
+	}
+}
+
+func TestPurgeFiles(t *testing.T) {
+	userID := 19
+	fileID := 821
+
+	notDeleted := PurgeFiles([]int{fileID}, userID, store, db)
+	if len(notDeleted) != 1 {
+		t.Errorf("PurgeFiles - %d, expected %d - file isn't trashed", len(notDeleted), 1)
+	}
+
+	DeleteFiles([]int{fileID}, userID, db)
+	notDeleted = PurgeFiles([]int{fileID}, userID, store, db)
+	if _, err := getFileByID(fileID, db); len(notDeleted) != 0 || err == nil {
+		t.Errorf("PurgeFiles - %d, expected %d - trashed file", len(notDeleted), 0)
+	}
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	userID := 19
+	fileID := 767
+
+	DeleteFiles([]int{fileID}, userID, db)
+	purged, err := PurgeExpiredTrash(time.Hour, store, db)
+	if err != nil || purged != 0 {
+		t.Errorf("PurgeExpiredTrash = %d; want `%d`, retention hasn't passed", purged, 0)
+	}
+
+	db.Exec(`UPDATE files SET trashed_at = now() - interval '2 hours' WHERE id = $1`, fileID)
+	purged, err = PurgeExpiredTrash(time.Hour, store, db)
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeExpiredTrash = %d; want `%d`", purged, 1)
+	}
+}
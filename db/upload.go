@@ -0,0 +1,368 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"photos/constants"
+	model "photos/model"
+	"photos/storage"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// A request writing to an upload claims it and refreshes the claim while bytes arrive. A claim
+// which isn't refreshed in time, e.g. of a crashed server, can be taken over
+const (
+	uploadLockTimeout = 5 * time.Minute
+	uploadLockRefresh = time.Minute
+)
+
+var selectUpload = `
+	SELECT id, name, mime, length, "offset", file, expires_at
+	FROM uploads
+	WHERE id = $1 AND owner = $2 AND expires_at > now()
+`
+
+// uploadPath returns where received bytes of the upload are kept until it's complete
+func uploadPath(dir, uploadID string) string {
+	return filepath.Join(dir, uploadID)
+}
+
+func uploadScanner(row *sql.Row) (model.Upload, error) {
+	upload := model.Upload{}
+	err := row.Scan(
+		&upload.ID,
+		&upload.Name,
+		&upload.MimeType,
+		&upload.Length,
+		&upload.Offset,
+		&upload.File,
+		&upload.ExpiresAt,
+	)
+
+	return upload, err
+}
+
+// CreateUpload starts a resumable upload of a file with the given length. Received bytes
+// are kept in the dir, the upload expires when it isn't finished in time
+func CreateUpload(
+	userID int,
+	name string,
+	mimeType string,
+	length int64,
+	maxSize int64,
+	expiration time.Duration,
+	dir string,
+	db *sql.DB,
+) (int, model.Upload, error) {
+	if length <= 0 {
+		return http.StatusBadRequest, model.Upload{}, errors.New(constants.STRINGS["uploadLengthInvalid"])
+	}
+	if maxSize > 0 && length > maxSize {
+		message := fmt.Sprintf(constants.STRINGS["uploadTooLarge"], maxSize)
+
+		return http.StatusRequestEntityTooLarge, model.Upload{}, errors.New(message)
+	}
+
+	uploadID, _, err := createToken()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate an upload id")
+
+		return http.StatusInternalServerError, model.Upload{}, err
+	}
+
+	f, err := os.OpenFile(uploadPath(dir, uploadID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't create an upload file")
+
+		return http.StatusInternalServerError, model.Upload{}, err
+	}
+	f.Close()
+
+	upload := model.Upload{
+		ID:        uploadID,
+		Name:      name,
+		MimeType:  mimeType,
+		Length:    length,
+		ExpiresAt: time.Now().Add(expiration),
+	}
+	rawQuery := `INSERT INTO uploads (id, owner, name, mime, length, expires_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = db.Exec(rawQuery, uploadID, userID, name, mimeType, length, upload.ExpiresAt)
+	if err != nil {
+		os.Remove(uploadPath(dir, uploadID))
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't create an upload")
+
+		return http.StatusInternalServerError, model.Upload{}, err
+	}
+
+	return http.StatusCreated, upload, nil
+}
+
+// GetUpload returns the user's upload which hasn't expired
+func GetUpload(uploadID string, userID int, db *sql.DB) (int, model.Upload) {
+	upload, err := uploadScanner(db.QueryRow(selectUpload, uploadID, userID))
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, upload
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't fetch an upload")
+
+		return http.StatusInternalServerError, upload
+	}
+
+	return http.StatusOK, upload
+}
+
+// completeUpload saves the received file the same way as multipart uploads do. The file is
+// inserted in the transaction which marks the upload complete. A failure of either rolls
+// both back to a savepoint, received bytes are kept and the upload can be retried
+func completeUpload(upload *model.Upload, userID int, dir string, store storage.Storage, tx *sql.Tx, db *sql.DB) int {
+	f, err := os.Open(uploadPath(dir, upload.ID))
+	if err == nil {
+		defer f.Close()
+		_, err = tx.Exec(`SAVEPOINT complete_upload`)
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", upload.ID).Msg("Can't read an upload")
+
+		return http.StatusInternalServerError
+	}
+
+	status := http.StatusNoContent
+	result := saveUpload(f, upload.Length, upload.Name, userID, store, tx, db)
+	var fileID int64
+	switch result.Status {
+	case constants.UploadStatus["created"]:
+		fileID = *result.File
+	case constants.UploadStatus["duplicate"]:
+		fileID = *result.DuplicateOf
+	case constants.UploadStatus["rejected"]:
+		status = http.StatusBadRequest
+	case constants.UploadStatus["failed"]:
+		status = http.StatusInternalServerError
+	}
+
+	if status == http.StatusNoContent {
+		_, err = tx.Exec(`UPDATE uploads SET file = $1, updated_at = now() WHERE id = $2`, fileID, upload.ID)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Str("upload", upload.ID).Msg("Can't complete an upload")
+
+			status = http.StatusInternalServerError
+		}
+	}
+	if status != http.StatusNoContent {
+		if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT complete_upload`); err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Str("upload", upload.ID).Msg("Can't roll back an upload")
+		}
+
+		return status
+	}
+
+	upload.File = null.IntFrom(fileID)
+
+	return http.StatusNoContent
+}
+
+// claimUpload marks the user's upload as being written by the writer. No transaction stays
+// open while the request body arrives, the claim keeps other requests out instead
+func claimUpload(uploadID string, userID int, writer string, db *sql.DB) (int, model.Upload, error) {
+	rawQuery := `
+		UPDATE uploads SET writer = $3, locked_at = now()
+		WHERE
+			id = $1 AND owner = $2 AND expires_at > now()
+			AND (locked_at IS NULL OR locked_at < now() - $4 * interval '1 second')
+		RETURNING id, name, mime, length, "offset", file, expires_at
+	`
+	upload, err := uploadScanner(db.QueryRow(rawQuery, uploadID, userID, writer, uploadLockTimeout.Seconds()))
+	if err == sql.ErrNoRows {
+		if status, _ := GetUpload(uploadID, userID, db); status != http.StatusOK {
+			return status, upload, errors.New(constants.STRINGS["uploadNotFound"])
+		}
+
+		return http.StatusConflict, upload, errors.New(constants.STRINGS["uploadLocked"])
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't claim an upload")
+
+		return http.StatusInternalServerError, upload, err
+	}
+
+	return http.StatusOK, upload, nil
+}
+
+// uploadWriter writes received bytes to the upload file. Before writing it refreshes the claim
+// when it's getting old and stops when another request took the upload over meanwhile
+type uploadWriter struct {
+	file      *os.File
+	uploadID  string
+	writer    string
+	refreshed time.Time
+	db        *sql.DB
+}
+
+func (w *uploadWriter) Write(data []byte) (int, error) {
+	if time.Since(w.refreshed) > uploadLockRefresh {
+		rawQuery := `UPDATE uploads SET locked_at = now() WHERE id = $1 AND writer = $2`
+		result, err := w.db.Exec(rawQuery, w.uploadID, w.writer)
+		if err != nil {
+			return 0, err
+		}
+		if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+			return 0, errors.New(constants.STRINGS["uploadLocked"])
+		}
+
+		w.refreshed = time.Now()
+	}
+
+	return w.file.Write(data)
+}
+
+// WriteUpload appends a chunk at the offset which has to match bytes received so far.
+// Bytes received before a dropped connection are kept, so the client can resume from
+// the offset returned by GetUpload. The last chunk saves the file, see ProcessFiles,
+// a chunk sent again after that changes nothing. Only one request can write to an
+// upload at once
+func WriteUpload(
+	uploadID string,
+	userID int,
+	offset int64,
+	body io.Reader,
+	dir string,
+	store storage.Storage,
+	db *sql.DB,
+) (int, model.Upload, error) {
+	writer, _, err := createToken()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't generate an upload writer")
+
+		return http.StatusInternalServerError, model.Upload{}, err
+	}
+
+	status, upload, err := claimUpload(uploadID, userID, writer, db)
+	if err != nil {
+		return status, upload, err
+	}
+	defer db.Exec(`UPDATE uploads SET writer = NULL, locked_at = NULL WHERE id = $1 AND writer = $2`, uploadID, writer)
+
+	if offset != upload.Offset {
+		return http.StatusConflict, upload, errors.New(constants.STRINGS["uploadOffsetMismatch"])
+	}
+	if upload.File.Valid {
+		return http.StatusNoContent, upload, nil
+	}
+
+	var written int64
+	var copyErr error
+	// A retried last chunk when the file couldn't be saved before has nothing to write
+	if offset < upload.Length {
+		f, err := os.OpenFile(uploadPath(dir, uploadID), os.O_WRONLY, 0600)
+		if err == nil {
+			// Bytes after the offset come from a request which failed before recording them
+			err = f.Truncate(offset)
+		}
+		if err == nil {
+			_, err = f.Seek(offset, io.SeekStart)
+		}
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't open an upload")
+			if f != nil {
+				f.Close()
+			}
+
+			return http.StatusInternalServerError, upload, err
+		}
+
+		w := &uploadWriter{file: f, uploadID: uploadID, writer: writer, refreshed: time.Now(), db: db}
+		written, copyErr = io.Copy(w, io.LimitReader(body, upload.Length-offset))
+		f.Close()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't start a transaction")
+
+		return http.StatusInternalServerError, upload, err
+	}
+	defer tx.Rollback()
+
+	upload.Offset += written
+	rawQuery := `UPDATE uploads SET "offset" = $1, updated_at = now() WHERE id = $2 AND writer = $3`
+	result, err := tx.Exec(rawQuery, upload.Offset, uploadID, writer)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't update an upload")
+
+		return http.StatusInternalServerError, upload, err
+	}
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusConflict, upload, errors.New(constants.STRINGS["uploadLocked"])
+	}
+
+	status = http.StatusNoContent
+	if copyErr != nil {
+		log.Warn().Err(copyErr).Caller().Int("user", userID).Str("upload", uploadID).Msg("Upload interrupted")
+
+		status = http.StatusBadRequest
+	} else if upload.Offset == upload.Length {
+		status = completeUpload(&upload, userID, dir, store, tx, db)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't update an upload")
+
+		return http.StatusInternalServerError, upload, err
+	}
+
+	if upload.File.Valid {
+		os.Remove(uploadPath(dir, uploadID))
+	}
+
+	return status, upload, copyErr
+}
+
+// DeleteUpload terminates the upload and removes received bytes
+func DeleteUpload(uploadID string, userID int, dir string, db *sql.DB) int {
+	result, err := db.Exec(`DELETE FROM uploads WHERE id = $1 AND owner = $2`, uploadID, userID)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Str("upload", uploadID).Msg("Can't delete an upload")
+
+		return http.StatusInternalServerError
+	}
+
+	if rowsNo, _ := result.RowsAffected(); rowsNo == 0 {
+		return http.StatusNotFound
+	}
+
+	os.Remove(uploadPath(dir, uploadID))
+
+	return http.StatusNoContent
+}
+
+// PurgeExpiredUploads removes uploads which weren't finished in time. Returns the number of removed uploads
+func PurgeExpiredUploads(dir string, db *sql.DB) (int, error) {
+	rows, err := db.Query(`DELETE FROM uploads WHERE expires_at <= now() RETURNING id`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	purged := 0
+	for rows.Next() {
+		var uploadID string
+		if err := rows.Scan(&uploadID); err != nil {
+			return purged, err
+		}
+
+		os.Remove(uploadPath(dir, uploadID))
+		purged++
+	}
+
+	return purged, rows.Err()
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteUpload(t *testing.T) {
+	userID := 8
+	dir, _ := ioutil.TempDir("", "uploads")
+	defer os.RemoveAll(dir)
+
+	status, _, _ := CreateUpload(userID, "big.jpg", "image/jpeg", 100, 10, time.Hour, dir, db)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("CreateUpload - status: %d, expected %d - file too large", status, http.StatusRequestEntityTooLarge)
+	}
+
+	status, upload, err := CreateUpload(userID, "notes.txt", "text/plain", 10, 100, time.Hour, dir, db)
+	if status != http.StatusCreated || err != nil || upload.ID == "" {
+		t.Errorf("CreateUpload - status: %d, expected %d - error: %s", status, http.StatusCreated, err)
+	}
+
+	status, _, _ = WriteUpload(upload.ID, userID, 4, strings.NewReader("chunk"), dir, store, db)
+	if status != http.StatusConflict {
+		t.Errorf("WriteUpload - status: %d, expected %d - offset mismatch", status, http.StatusConflict)
+	}
+
+	status, _, _ = WriteUpload(upload.ID, userID+1, 0, strings.NewReader("chunk"), dir, store, db)
+	if status != http.StatusNotFound {
+		t.Errorf("WriteUpload - status: %d, expected %d - not an owner", status, http.StatusNotFound)
+	}
+
+	status, _, err = WriteUpload(upload.ID, userID, 0, strings.NewReader("first"), dir, store, db)
+	_, resumed := GetUpload(upload.ID, userID, db)
+	if status != http.StatusNoContent || err != nil || resumed.Offset != 5 {
+		t.Errorf("WriteUpload - offset %d, expected %d - error: %s", resumed.Offset, 5, err)
+	}
+
+	status, written, _ := WriteUpload(upload.ID, userID, 5, strings.NewReader("part and more"), dir, store, db)
+	data, _ := ioutil.ReadFile(uploadPath(dir, upload.ID))
+	if status != http.StatusBadRequest || written.Offset != 10 || string(data) != "firstpart " {
+		t.Errorf("WriteUpload - status: %d, expected %d - only jpeg/png are saved", status, http.StatusBadRequest)
+	}
+
+	db.Exec(`UPDATE uploads SET writer = 'other', locked_at = now() WHERE id = $1`, upload.ID)
+	if status, _, _ = WriteUpload(upload.ID, userID, 10, strings.NewReader(""), dir, store, db); status != http.StatusConflict {
+		t.Errorf("WriteUpload - status: %d, expected %d - written by another request", status, http.StatusConflict)
+	}
+
+	// The claim of a request which stopped refreshing it is taken over. A complete upload has nothing to write
+	files, _ := GetFiles(userID, db)
+	if len(files) > 0 {
+		rawQuery := `UPDATE uploads SET file = $2, locked_at = now() - interval '1 hour' WHERE id = $1`
+		db.Exec(rawQuery, upload.ID, files[0].ID)
+		status, complete, err := WriteUpload(upload.ID, userID, 10, strings.NewReader(""), dir, store, db)
+		if status != http.StatusNoContent || err != nil || complete.Offset != 10 {
+			t.Errorf("WriteUpload - status: %d, expected %d - upload is complete - error: %s", status, http.StatusNoContent, err)
+		}
+	}
+
+	if status = DeleteUpload(upload.ID, userID, dir, db); status != http.StatusNoContent {
+		t.Errorf("DeleteUpload - status: %d, expected %d", status, http.StatusNoContent)
+	}
+	if _, err := os.Stat(uploadPath(dir, upload.ID)); !os.IsNotExist(err) {
+		t.Errorf("DeleteUpload - received bytes must be removed")
+	}
+}
+
+func TestPurgeExpiredUploads(t *testing.T) {
+	userID := 8
+	dir, _ := ioutil.TempDir("", "uploads")
+	defer os.RemoveAll(dir)
+
+	_, upload, _ := CreateUpload(userID, "photo.jpg", "image/jpeg", 10, 100, time.Hour, dir, db)
+	db.Exec(`UPDATE uploads SET expires_at = now() - interval '1 minute' WHERE id = $1`, upload.ID)
+
+	purged, err := PurgeExpiredUploads(dir, db)
+	status, _ := GetUpload(upload.ID, userID, db)
+	if err != nil || purged != 1 || status != http.StatusNotFound {
+		t.Errorf("PurgeExpiredUploads = %d; want `%d`", purged, 1)
+	}
+}
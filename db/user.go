@@ -0,0 +1,182 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	constants "photos/constants"
+	model "photos/model"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const minPasswordLength = 8
+const sessionDuration = 30 * 24 * time.Hour
+
+// uniqueViolation is the Postgres error of a duplicate value in a unique column
+const uniqueViolation = "23505"
+
+// createToken returns a random token and its hash. Only the hash is stored in db
+// so a leaked database doesn't give access to accounts
+func createToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token := hex.EncodeToString(buf)
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func getUserByEmail(email string, db *sql.DB) (model.User, string, error) {
+	var user model.User
+	var password sql.NullString
+
+	query := `SELECT id, first_name, last_name, email, password FROM users WHERE email = $1`
+	row := db.QueryRow(query, email)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &password)
+
+	return user, password.String, err
+}
+
+// GetUser returns a user by id
+func GetUser(userID int, db *sql.DB) (model.User, error) {
+	var user model.User
+
+	query := `SELECT id, first_name, last_name, email FROM users WHERE id = $1`
+	row := db.QueryRow(query, userID)
+	err := row.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email)
+
+	return user, err
+}
+
+// CreateUser registers a new account. Email is stored lowercased so it can be
+// used for logging in regardless of the letter case
+func CreateUser(firstName, lastName, email, password string, db *sql.DB) (int, model.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if firstName == "" || lastName == "" || email == "" || password == "" {
+		return http.StatusBadRequest, model.User{}, errors.New(constants.STRINGS["missingUserData"])
+	}
+
+	if len(password) < minPasswordLength {
+		return http.StatusBadRequest, model.User{}, errors.New(constants.STRINGS["passwordTooShort"])
+	}
+
+	_, _, err := getUserByEmail(email, db)
+	if err != sql.ErrNoRows {
+		if err != nil {
+			log.Error().Err(err).Caller().Str("email", email).Msg("Can't check the email")
+
+			return http.StatusInternalServerError, model.User{}, err
+		}
+
+		return http.StatusConflict, model.User{}, errors.New(constants.STRINGS["emailTaken"])
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error().Err(err).Caller().Str("email", email).Msg("Can't hash a password")
+
+		return http.StatusInternalServerError, model.User{}, err
+	}
+
+	user := model.User{FirstName: firstName, LastName: lastName, Email: email}
+	query := `
+		INSERT INTO users(first_name, last_name, email, password)
+		VALUES($1, $2, $3, $4)
+		RETURNING id
+	`
+	err = db.QueryRow(query, firstName, lastName, email, string(hash)).Scan(&user.ID)
+	// Another registration with the email may have been saved since the check
+	if err, ok := err.(*pq.Error); ok && err.Code == uniqueViolation {
+		return http.StatusConflict, model.User{}, errors.New(constants.STRINGS["emailTaken"])
+	}
+	if err != nil {
+		log.Error().Err(err).Caller().Str("email", email).Msg("Can't create a user")
+
+		return http.StatusInternalServerError, model.User{}, err
+	}
+
+	return http.StatusCreated, user, nil
+}
+
+func createSession(userID int, db *sql.DB) (string, error) {
+	token, hash, err := createToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO sessions("user", token, expires_at) VALUES($1, $2, $3)`
+	_, err = db.Exec(query, userID, hash, time.Now().Add(sessionDuration))
+
+	return token, err
+}
+
+// Login checks user's credentials and returns a new session token
+func Login(email, password string, db *sql.DB) (int, string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	user, hash, err := getUserByEmail(email, db)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error().Err(err).Caller().Str("email", email).Msg("Can't fetch a user")
+
+		return http.StatusInternalServerError, "", err
+	}
+
+	// accounts created before passwords were introduced have no hash and can't log in
+	if err == sql.ErrNoRows || hash == "" ||
+		bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return http.StatusUnauthorized, "", errors.New(constants.STRINGS["invalidCredentials"])
+	}
+
+	token, err := createSession(user.ID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", user.ID).Msg("Can't create a session")
+
+		return http.StatusInternalServerError, "", err
+	}
+
+	return http.StatusOK, token, nil
+}
+
+// GetSessionUser returns id of the user owning a not expired session
+func GetSessionUser(token string, db *sql.DB) (int, error) {
+	var userID int
+	if token == "" {
+		return 0, errors.New(constants.STRINGS["unauthorized"])
+	}
+
+	query := `SELECT "user" FROM sessions WHERE token = $1 AND expires_at > now()`
+	err := db.QueryRow(query, hashToken(token)).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Error().Err(err).Caller().Msg("Can't fetch a session")
+		}
+
+		return 0, errors.New(constants.STRINGS["unauthorized"])
+	}
+
+	return userID, nil
+}
+
+// Logout removes the session. Expired sessions of the user are removed as well
+func Logout(token string, userID int, db *sql.DB) error {
+	query := `DELETE FROM sessions WHERE "user" = $1 AND (token = $2 OR expires_at <= now())`
+	_, err := db.Exec(query, userID, hashToken(token))
+
+	return err
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateUser(t *testing.T) {
+	email := "John.Doe@example.com"
+	status, user, err := CreateUser("John", "Doe", email, "secret-password", db)
+	if status != http.StatusCreated || err != nil || user.ID == 0 {
+		t.Errorf("CreateUser - status: %d, expected %d - error: %s", status, http.StatusCreated, err)
+	}
+
+	status, _, _ = CreateUser("John", "Doe", "john.doe@example.com", "secret-password", db)
+	if status != http.StatusConflict {
+		t.Errorf("CreateUser - status: %d, expected %d - email taken", status, http.StatusConflict)
+	}
+
+	status, _, _ = CreateUser("John", "Doe", "short@example.com", "short", db)
+	if status != http.StatusBadRequest {
+		t.Errorf("CreateUser - status: %d, expected %d - password too short", status, http.StatusBadRequest)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	email := "login@example.com"
+	password := "secret-password"
+	_, user, _ := CreateUser("Jane", "Doe", email, password, db)
+
+	status, token, err := Login("LOGIN@example.com", password, db)
+	if status != http.StatusOK || err != nil || token == "" {
+		t.Errorf("Login - status: %d, expected %d - error: %s", status, http.StatusOK, err)
+	}
+
+	userID, err := GetSessionUser(token, db)
+	if err != nil || userID != user.ID {
+		t.Errorf("GetSessionUser - %d, expected %d - error: %s", userID, user.ID, err)
+	}
+
+	status, _, _ = Login(email, "wrong-password", db)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Login - status: %d, expected %d - wrong password", status, http.StatusUnauthorized)
+	}
+
+	// seeded users don't have a password
+	status, _, _ = Login("elanmeid0@com.com", "", db)
+	if status != http.StatusUnauthorized {
+		t.Errorf("Login - status: %d, expected %d - user without password", status, http.StatusUnauthorized)
+	}
+
+	err = Logout(token, user.ID, db)
+	if _, sessionErr := GetSessionUser(token, db); err != nil || sessionErr == nil {
+		t.Errorf("Logout - session %s should be removed - error: %s", token, err)
+	}
+}
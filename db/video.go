@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"os"
+
+	model "photos/model"
+	"photos/storage"
+	"photos/video"
+)
+
+// videoTempFile copies the original to a temporary file, ffmpeg needs to seek in it.
+// The caller removes the file
+func videoTempFile(hash string, store storage.Storage) (string, error) {
+	f, err := store.Get(hash)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	tmp, err := ioutil.TempFile("", "video-")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, f)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// createPreview transcodes the video to the low resolution preview and puts it to the storage
+func createPreview(path, hash string, store storage.Storage) (model.Rendition, error) {
+	tmp, err := ioutil.TempFile("", "preview-")
+	if err != nil {
+		return model.Rendition{}, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := video.Preview(path, tmp.Name()); err != nil {
+		return model.Rendition{}, err
+	}
+
+	info, err := video.ExtractMetadata(tmp.Name())
+	if err != nil {
+		return model.Rendition{}, err
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return model.Rendition{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return model.Rendition{}, err
+	}
+
+	key := renditionKey(hash, video.PreviewName, "mp4")
+	if err := store.Put(key, f, stat.Size(), video.PreviewMimeType); err != nil {
+		return model.Rendition{}, err
+	}
+
+	return model.Rendition{
+		Name:     video.PreviewName,
+		MimeType: video.PreviewMimeType,
+		Width:    info.Width.Int64,
+		Height:   info.Height.Int64,
+		Size:     stat.Size(),
+		Key:      key,
+	}, nil
+}
+
+// processVideo reads metadata of the video from its container. Image renditions are
+// created from a poster frame, besides them the video gets a low resolution preview.
+// Renditions stored for the same content by another file are reused
+func processVideo(file model.File, store storage.Storage, db *sql.DB) (model.File, []model.Rendition, error) {
+	path, err := videoTempFile(file.Hash.String, store)
+	if err != nil {
+		return file, nil, err
+	}
+	defer os.Remove(path)
+
+	info, err := video.ExtractMetadata(path)
+	if err != nil {
+		return file, nil, err
+	}
+	info.MimeType = file.MimeType
+	info.Extension = file.Extension
+
+	renditions, err := getBlobRenditions(file.Hash.String, 0, nil, db)
+	if err != nil || len(renditions) > 0 {
+		return info, renditions, err
+	}
+
+	poster, err := video.Poster(path, info.Duration.Float64)
+	if err != nil {
+		return info, nil, err
+	}
+
+	renditions, err = createRenditions(poster, file.Hash.String, 0, nil, store)
+	if err != nil {
+		return info, renditions, err
+	}
+
+	preview, err := createPreview(path, file.Hash.String, store)
+	if err != nil {
+		return info, renditions, err
+	}
+
+	return info, append(renditions, preview), nil
+}
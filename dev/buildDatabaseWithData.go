@@ -30,6 +30,7 @@ func ResetDatabase(database *sql.DB) {
 	executeSQLFile("../dev/database/schema.sql")
 	executeSQLFile("../dev/database/users.sql")
 	executeSQLFile("../dev/database/files.sql")
+	executeSQLFile("../dev/database/blobs.sql")
 	executeSQLFile("../dev/database/albums.sql")
 	executeSQLFile("../dev/database/user_album.sql")
 	executeSQLFile("../dev/database/album_file.sql")
@@ -0,0 +1,2 @@
+INSERT INTO "public"."blobs" ("hash", "refs", "size")
+SELECT "hash", count(*), max("size") FROM "public"."files" GROUP BY "hash";
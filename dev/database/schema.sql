@@ -1,5 +1,10 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
 DROP TYPE IF EXISTS "public"."file_type";
 CREATE TYPE "public"."file_type" AS ENUM ('IMAGE', 'VIDEO', 'ANIMATION', 'COLLAGE');
+DROP TYPE IF EXISTS "public"."file_status";
+CREATE TYPE "public"."file_status" AS ENUM ('PROCESSING', 'READY', 'FAILED');
+DROP TYPE IF EXISTS "public"."job_status";
+CREATE TYPE "public"."job_status" AS ENUM ('QUEUED', 'RUNNING', 'DONE', 'FAILED');
 -- Sequence and defined type
 CREATE SEQUENCE IF NOT EXISTS users_id_seq;
 -- Table Definition
@@ -8,6 +13,8 @@ CREATE TABLE IF NOT EXISTS "public"."users" (
   "first_name" varchar NOT NULL,
   "last_name" varchar NOT NULL,
   "email" varchar NOT NULL,
+  "password" varchar,
+  CONSTRAINT "users_email_key" UNIQUE ("email"),
   PRIMARY KEY ("id")
 );
 -- Sequence and defined type
@@ -16,6 +23,7 @@ CREATE SEQUENCE IF NOT EXISTS files_id_seq;
 CREATE TABLE IF NOT EXISTS "public"."files" (
   "id" int4 NOT NULL DEFAULT nextval('files_id_seq' :: regclass),
   "type" "public"."file_type" NOT NULL,
+  "status" "public"."file_status" NOT NULL DEFAULT 'READY',
   "owner" int4 NOT NULL,
   "name" varchar NOT NULL,
   "hash" varchar NOT NULL,
@@ -34,9 +42,31 @@ CREATE TABLE IF NOT EXISTS "public"."files" (
   "width" int2,
   "height" int2,
   "date" timestamptz,
+  "duration" float8,
+  "codec" varchar,
+  "lens_make" varchar,
+  "lens_model" varchar,
+  "flash" bool,
+  "white_balance" varchar,
+  "metering_mode" varchar,
+  "exposure_bias" float4,
+  "software" varchar,
+  "copyright" varchar,
+  "title" varchar,
+  "caption" text,
+  "keywords" text[],
+  "rating" int2,
+  "tags" text[] NOT NULL DEFAULT '{}',
+  "place" varchar,
+  "search" tsvector,
+  "exif" jsonb,
+  "rotation" int2 NOT NULL DEFAULT 0,
+  "edits" jsonb NOT NULL DEFAULT '[]',
+  "trashed_at" timestamptz,
   "updated_at" timestamptz DEFAULT now(),
   "created_at" timestamptz DEFAULT now(),
   CONSTRAINT "files_owner_fkey" FOREIGN KEY ("owner") REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  CONSTRAINT "files_rotation_check" CHECK ("rotation" IN (0, 90, 180, 270)),
   PRIMARY KEY ("id")
 );
 -- Sequence and defined type
@@ -46,6 +76,7 @@ CREATE TABLE "public"."albums" (
     "id" int4 NOT NULL DEFAULT nextval('albums_id_seq'::regclass),
     "owner" int4 NOT NULL,
     "name" varchar NOT NULL,
+    "search" tsvector,
     "size" int4 NOT NULL DEFAULT '0'::bigint,
     "cover" int4,
     "updated_at" time DEFAULT now(),
@@ -97,3 +128,174 @@ CREATE TABLE IF NOT EXISTS "public"."user_file" (
   CONSTRAINT "user_file_file_fkey" FOREIGN KEY ("file") REFERENCES "public"."files" ("id") ON DELETE CASCADE,
   PRIMARY KEY ("id")
 );
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS sessions_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."sessions" (
+  "id" int4 NOT NULL DEFAULT nextval('sessions_id_seq' :: regclass),
+  "user" int4 NOT NULL,
+  "token" varchar NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "sessions_user_fkey" FOREIGN KEY ("user") REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  CONSTRAINT "sessions_token_key" UNIQUE ("token"),
+  PRIMARY KEY ("id")
+);
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS api_tokens_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."api_tokens" (
+  "id" int4 NOT NULL DEFAULT nextval('api_tokens_id_seq' :: regclass),
+  "user" int4 NOT NULL,
+  "name" varchar NOT NULL,
+  "token" varchar NOT NULL,
+  "scopes" varchar[] NOT NULL DEFAULT '{}',
+  "last_used_at" timestamptz,
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "api_tokens_user_fkey" FOREIGN KEY ("user") REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  CONSTRAINT "api_tokens_token_key" UNIQUE ("token"),
+  PRIMARY KEY ("id")
+);
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS album_links_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."album_links" (
+  "id" int4 NOT NULL DEFAULT nextval('album_links_id_seq' :: regclass),
+  "album" int4 NOT NULL,
+  "token" varchar NOT NULL,
+  "password" varchar,
+  "allow_download" bool NOT NULL DEFAULT false,
+  "expires_at" timestamptz,
+  "created_by" int4,
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "album_links_album_fkey" FOREIGN KEY ("album") REFERENCES "public"."albums" ("id") ON DELETE CASCADE,
+  CONSTRAINT "album_links_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "public"."users" ("id") ON DELETE SET NULL,
+  CONSTRAINT "album_links_token_key" UNIQUE ("token"),
+  PRIMARY KEY ("id")
+);
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."blobs" (
+  "hash" varchar NOT NULL,
+  "refs" int4 NOT NULL DEFAULT 0,
+  "size" int8 NOT NULL DEFAULT 0,
+  "created_at" timestamptz DEFAULT now(),
+  PRIMARY KEY ("hash")
+);
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS renditions_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."renditions" (
+  "id" int4 NOT NULL DEFAULT nextval('renditions_id_seq' :: regclass),
+  "file" int4 NOT NULL,
+  "name" varchar NOT NULL,
+  "mime" varchar NOT NULL,
+  "width" int4 NOT NULL,
+  "height" int4 NOT NULL,
+  "size" int8 NOT NULL DEFAULT 0,
+  "key" varchar NOT NULL,
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "renditions_file_fkey" FOREIGN KEY ("file") REFERENCES "public"."files" ("id") ON DELETE CASCADE,
+  CONSTRAINT "renditions_file_name_mime_key" UNIQUE ("file", "name", "mime"),
+  PRIMARY KEY ("id")
+);
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS jobs_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."jobs" (
+  "id" int4 NOT NULL DEFAULT nextval('jobs_id_seq' :: regclass),
+  "file" int4 NOT NULL,
+  "status" "public"."job_status" NOT NULL DEFAULT 'QUEUED',
+  "attempts" int2 NOT NULL DEFAULT 0,
+  "last_error" varchar,
+  "run_at" timestamptz NOT NULL DEFAULT now(),
+  "locked_at" timestamptz,
+  "updated_at" timestamptz DEFAULT now(),
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "jobs_file_fkey" FOREIGN KEY ("file") REFERENCES "public"."files" ("id") ON DELETE CASCADE,
+  PRIMARY KEY ("id")
+);
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."uploads" (
+  "id" varchar NOT NULL,
+  "owner" int4 NOT NULL,
+  "name" varchar NOT NULL,
+  "mime" varchar NOT NULL,
+  "length" int8 NOT NULL,
+  "offset" int8 NOT NULL DEFAULT 0,
+  "file" int4,
+  "expires_at" timestamptz NOT NULL,
+  "writer" varchar,
+  "locked_at" timestamptz,
+  "updated_at" timestamptz DEFAULT now(),
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "uploads_owner_fkey" FOREIGN KEY ("owner") REFERENCES "public"."users" ("id") ON DELETE CASCADE,
+  CONSTRAINT "uploads_file_fkey" FOREIGN KEY ("file") REFERENCES "public"."files" ("id") ON DELETE SET NULL,
+  PRIMARY KEY ("id")
+);
+-- Sequence and defined type
+CREATE SEQUENCE IF NOT EXISTS file_source_id_seq;
+-- Table Definition
+CREATE TABLE IF NOT EXISTS "public"."file_source" (
+  "id" int4 NOT NULL DEFAULT nextval('file_source_id_seq' :: regclass),
+  "file" int4 NOT NULL,
+  "source" int4,
+  "position" int2 NOT NULL,
+  "created_at" timestamptz DEFAULT now(),
+  CONSTRAINT "file_source_file_fkey" FOREIGN KEY ("file") REFERENCES "public"."files" ("id") ON DELETE CASCADE,
+  CONSTRAINT "file_source_source_fkey" FOREIGN KEY ("source") REFERENCES "public"."files" ("id") ON DELETE SET NULL,
+  CONSTRAINT "file_source_file_position_key" UNIQUE ("file", "position"),
+  PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "files_owner_hash_idx" ON "public"."files" ("owner", "hash");
+CREATE INDEX IF NOT EXISTS "files_trashed_at_idx" ON "public"."files" ("trashed_at") WHERE "trashed_at" IS NOT NULL;
+CREATE INDEX IF NOT EXISTS "jobs_status_run_at_idx" ON "public"."jobs" ("status", "run_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "jobs_file_queued_idx" ON "public"."jobs" ("file") WHERE "status" = 'QUEUED';
+CREATE INDEX IF NOT EXISTS "file_source_source_idx" ON "public"."file_source" ("source");
+CREATE INDEX IF NOT EXISTS "files_owner_taken_at_idx" ON "public"."files" ("owner", (coalesce("date", "created_at")) DESC, "id" DESC) WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_camera_model_idx" ON "public"."files" (lower("camera"), lower("model")) WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_lens_model_idx" ON "public"."files" (lower("lens_model")) WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_iso_idx" ON "public"."files" ("iso") WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_f_number_idx" ON "public"."files" ("f_number") WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_focal_length_idx" ON "public"."files" ("focal_length") WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_owner_mime_idx" ON "public"."files" ("owner", "mime", "type") WHERE "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_gps_idx" ON "public"."files" ("owner") WHERE "latitude" IS NOT NULL AND "longitude" IS NOT NULL AND "trashed_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "files_name_trgm_idx" ON "public"."files" USING gin ("name" gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS "album_file_album_file_idx" ON "public"."album_file" ("album", "file");
+CREATE INDEX IF NOT EXISTS "album_file_file_idx" ON "public"."album_file" ("file");
+-- Text search configuration in which files and albums are indexed and searched, one row
+CREATE TABLE IF NOT EXISTS "public"."search_config" (
+  "id" bool NOT NULL DEFAULT true,
+  "language" regconfig NOT NULL DEFAULT 'simple',
+  CONSTRAINT "search_config_single_row_check" CHECK ("id"),
+  PRIMARY KEY ("id")
+);
+INSERT INTO "public"."search_config" DEFAULT VALUES ON CONFLICT DO NOTHING;
+-- Words of files to search by
+CREATE OR REPLACE FUNCTION "public"."files_search_update"() RETURNS trigger AS $$
+DECLARE
+  config regconfig := (SELECT "language" FROM "public"."search_config");
+BEGIN
+  NEW.search :=
+    setweight(to_tsvector(config, coalesce(NEW.title, '')), 'A') ||
+    setweight(to_tsvector(config, array_to_string(NEW.tags || coalesce(NEW.keywords, '{}'), ' ')), 'A') ||
+    setweight(to_tsvector(config, regexp_replace(NEW.name, '[._-]+', ' ', 'g')), 'B') ||
+    setweight(to_tsvector(config, coalesce(NEW.caption, '')), 'B') ||
+    setweight(to_tsvector(config, coalesce(NEW.place, '')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS "files_search_update" ON "public"."files";
+CREATE TRIGGER "files_search_update" BEFORE INSERT OR UPDATE OF "name", "title", "caption", "keywords", "tags", "place" ON "public"."files"
+  FOR EACH ROW EXECUTE PROCEDURE "public"."files_search_update"();
+CREATE INDEX IF NOT EXISTS "files_search_idx" ON "public"."files" USING gin ("search");
+-- Words of albums to search by
+CREATE OR REPLACE FUNCTION "public"."albums_search_update"() RETURNS trigger AS $$
+BEGIN
+  NEW.search := to_tsvector((SELECT "language" FROM "public"."search_config"), NEW.name);
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS "albums_search_update" ON "public"."albums";
+CREATE TRIGGER "albums_search_update" BEFORE INSERT OR UPDATE OF "name" ON "public"."albums"
+  FOR EACH ROW EXECUTE PROCEDURE "public"."albums_search_update"();
+CREATE INDEX IF NOT EXISTS "albums_search_idx" ON "public"."albums" USING gin ("search");
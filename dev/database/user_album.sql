@@ -32,7 +32,7 @@ INSERT INTO "public"."user_album" ("id", "user", "album", "privilege", "updated_
 (DEFAULT, '9', '92', '0', '2020-01-16 22:29:55+01', '2020-06-18 06:27:47+02'),
 (DEFAULT, '19', '91', '0', '2020-04-15 18:16:34+02', '2020-02-02 04:00:08+01'),
 (DEFAULT, '12', '87', '0', '2020-03-31 02:53:54+02', '2019-07-05 15:37:43+02'),
-(DEFAULT, '6', '60', '0', '2019-10-24 00:47:04+02', '2019-11-30 00:40:08+01'),
+(DEFAULT, '6', '60', '2', '2019-10-24 00:47:04+02', '2019-11-30 00:40:08+01'),
 (DEFAULT, '5', '73', '0', '2020-01-16 15:30:59+01', '2020-02-29 01:56:26+01'),
 (DEFAULT, '12', '57', '0', '2020-05-15 07:01:03+02', '2020-04-20 09:36:46+02'),
 (DEFAULT, '12', '100', '0', '2020-06-06 14:12:04+02', '2020-03-03 18:32:40+01'),
@@ -152,7 +152,7 @@ INSERT INTO "public"."user_album" ("id", "user", "album", "privilege", "updated_
 (DEFAULT, '6', '16', '0', '2020-02-25 17:07:30+01', '2019-11-08 08:16:17+01'),
 (DEFAULT, '11', '11', '0', '2020-04-09 23:21:07+02', '2020-03-14 21:19:39+01'),
 (DEFAULT, '1', '83', '0', '2019-11-26 02:46:31+01', '2020-02-26 05:05:13+01'),
-(DEFAULT, '9', '26', '0', '2019-09-25 17:23:33+02', '2019-10-24 07:20:09+02'),
+(DEFAULT, '9', '26', '1', '2019-09-25 17:23:33+02', '2019-10-24 07:20:09+02'),
 (DEFAULT, '12', '3', '0', '2019-12-20 20:38:29+01', '2020-02-18 09:17:09+01'),
 (DEFAULT, '6', '29', '0', '2020-03-19 23:38:30+01', '2019-12-05 09:14:01+01'),
 (DEFAULT, '4', '23', '0', '2019-10-23 21:07:17+02', '2020-02-23 01:03:37+01'),
@@ -176,14 +176,14 @@ INSERT INTO "public"."user_album" ("id", "user", "album", "privilege", "updated_
 (DEFAULT, '7', '45', '0', '2019-11-02 09:25:32+01', '2019-10-09 03:53:31+02'),
 (DEFAULT, '1', '34', '0', '2019-11-24 23:24:54+01', '2019-12-13 06:31:40+01'),
 (DEFAULT, '5', '25', '0', '2019-09-04 18:57:56+02', '2020-01-05 09:29:03+01'),
-(DEFAULT, '9', '14', '0', '2019-12-25 23:55:31+01', '2019-11-15 09:24:18+01'),
+(DEFAULT, '9', '14', '1', '2019-12-25 23:55:31+01', '2019-11-15 09:24:18+01'),
 (DEFAULT, '1', '83', '0', '2019-12-16 10:23:59+01', '2019-12-05 21:54:06+01'),
 (DEFAULT, '3', '20', '0', '2019-12-24 21:50:52+01', '2020-04-29 02:04:21+02'),
 (DEFAULT, '20', '65', '0', '2020-04-25 12:31:26+02', '2019-07-12 21:11:06+02'),
 (DEFAULT, '1', '36', '0', '2019-09-27 17:02:37+02', '2020-06-17 23:00:51+02'),
 (DEFAULT, '5', '96', '0', '2020-05-03 10:42:47+02', '2020-03-05 21:50:01+01'),
 (DEFAULT, '3', '72', '0', '2020-05-12 15:11:39+02', '2020-06-16 08:56:47+02'),
-(DEFAULT, '9', '69', '0', '2019-06-23 07:31:51+02', '2019-06-25 07:01:00+02'),
+(DEFAULT, '9', '69', '2', '2019-06-23 07:31:51+02', '2019-06-25 07:01:00+02'),
 (DEFAULT, '20', '73', '0', '2019-07-16 00:20:14+02', '2019-10-05 12:40:20+02'),
 (DEFAULT, '16', '41', '0', '2019-09-24 16:21:27+02', '2020-04-03 13:25:32+02'),
 (DEFAULT, '7', '51', '0', '2019-10-13 02:17:57+02', '2019-09-11 20:36:17+02'),
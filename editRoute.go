@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appDB "photos/db"
+	model "photos/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// editResponse responds with the edited file or why it couldn't be edited
+func editResponse(w http.ResponseWriter, status int, file model.File, err error) {
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+	if status >= http.StatusBadRequest {
+		w.WriteHeader(status)
+		return
+	}
+
+	response, _ := json.Marshal(file)
+	jsonResponse(w, status, string(response))
+}
+
+func rotateFileRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var payload struct {
+		Degrees int64 `json:"degrees"` // clockwise, negative turns counterclockwise
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a rotation")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, file, err := appDB.RotateFile(fileID, userID, payload.Degrees, db)
+	editResponse(w, status, file, err)
+}
+
+func addEditRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var edit model.Edit
+	if err := json.NewDecoder(r.Body).Decode(&edit); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse an edit")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, file, err := appDB.AddEdit(fileID, userID, edit, db)
+	editResponse(w, status, file, err)
+}
+
+func undoEditRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, file, err := appDB.UndoEdit(fileID, userID, db)
+	editResponse(w, status, file, err)
+}
+
+func revertFileRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, file, err := appDB.RevertFile(fileID, userID, db)
+	editResponse(w, status, file, err)
+}
+
+func copyFileRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, file, err := appDB.CopyFile(fileID, userID, db)
+	editResponse(w, status, file, err)
+}
+
+func setFileTagsRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var payload struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse tags")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, file, err := appDB.SetFileTags(fileID, userID, payload.Tags, db)
+	editResponse(w, status, file, err)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+func fetchSharedFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	files, err := appDB.GetSharedFiles(userID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch shared files")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func fetchFileMembersRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, members := appDB.GetFileMembers(fileID, userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+func addFileMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	payload, ok := parseMemberPayload(r, userID)
+	if err != nil || !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, err := appDB.AddFileMember(fileID, userID, payload.User, payload.Privilege, db)
+	memberResponse(w, status, err)
+}
+
+func changeFileMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	payload, ok := parseMemberPayload(r, userID)
+	if err != nil || !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, err := appDB.ChangeFileMember(fileID, userID, payload.User, payload.Privilege, db)
+	memberResponse(w, status, err)
+}
+
+func removeFileMemberRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	payload, ok := parseMemberPayload(r, userID)
+	if err != nil || !ok {
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status := appDB.RemoveFileMember(fileID, userID, payload.User, db)
+	jsonResponse(w, status, "")
+}
@@ -2,15 +2,19 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	appDB "photos/db"
+	model "photos/model"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/rs/zerolog/log"
 )
 
-func deleteFileRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func deleteFileRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
 	enableCors(&w)
 	type Payload struct {
 		ID []int `json:"id"`
@@ -40,17 +44,25 @@ func deleteFileRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 	w.WriteHeader(http.StatusOK)
 }
 
-func uploadFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func uploadFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
 	enableCors(&w)
 
-	r.ParseMultipartForm(32 << 20) // 32MB is the default used by FormFile
+	err := r.ParseMultipartForm(32 << 20) // 32MB is the default used by FormFile
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse uploaded files")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	files := r.MultipartForm.File["files"]
-	status := appDB.ProcessFiles(files, userID, UploadDir, db)
+	status, results := appDB.ProcessFiles(files, userID, store, db)
 
-	w.WriteHeader(status)
+	response, _ := json.Marshal(results)
+	jsonResponse(w, status, string(response))
 }
 
-func fetchFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func fetchFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
 	enableCors(&w)
 	files, err := appDB.GetFiles(userID, db)
 	if err != nil {
@@ -62,3 +74,73 @@ func fetchFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params
 
 	json.NewEncoder(w).Encode(files)
 }
+
+// presignExpiration is how long a redirect to the storage stays valid
+const presignExpiration = 15 * time.Minute
+
+// serveFile sends a variant of the file. When the storage can hand out direct URLs
+// the client is redirected there. Otherwise http.ServeContent takes care of Range
+// requests and conditional GETs, ETag comes from the stored key which never changes for a file.
+// Renditions are negotiated on the Accept header, so caches have to vary on it. HEAD is answered
+// by the app as URLs of the storage are signed for GET only
+func serveFile(w http.ResponseWriter, r *http.Request, file model.File, variant string) {
+	key, mimeType, ok := resolveVariant(r, file, variant)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if variant != "original" {
+		w.Header().Set("Vary", "Accept")
+	}
+
+	url, err := store.PresignedURL(key, presignExpiration)
+	if err == nil && r.Method != http.MethodHead {
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+		return
+	}
+
+	stat, err := store.Stat(key)
+	if err != nil {
+		log.Error().Err(err).Caller().Int64("file", file.ID.Int64).Str("variant", variant).Msg("Can't stat a file")
+
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f, err := store.Get(key)
+	if err != nil {
+		log.Error().Err(err).Caller().Int64("file", file.ID.Int64).Str("variant", variant).Msg("Can't open a file")
+
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	header := w.Header()
+	header.Set("ETag", fmt.Sprintf(`"%s"`, key))
+	header.Set("Cache-Control", "private, max-age=86400")
+	if mimeType != "" {
+		header.Set("Content-Type", mimeType)
+	}
+
+	http.ServeContent(w, r, "", stat.ModTime, f)
+}
+
+func serveFileRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, file := appDB.GetViewableFile(fileID, userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	serveFile(w, r, file, p.ByName("variant"))
+}
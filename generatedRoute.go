@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"photos/constants"
+	appDB "photos/db"
+	"photos/image"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+func createCollageRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	var payload struct {
+		Files      []int  `json:"files"`
+		Columns    int    `json:"columns"`
+		CellSize   int64  `json:"cellSize"`
+		Spacing    int64  `json:"spacing"`
+		Background string `json:"background"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a collage")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	layout := image.CollageLayout{
+		Columns:    payload.Columns,
+		CellSize:   payload.CellSize,
+		Spacing:    payload.Spacing,
+		Background: payload.Background,
+	}
+	status, file, err := appDB.CreateCollage(payload.Files, layout, userID, store, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(file)
+	jsonResponse(w, status, string(response))
+}
+
+func createAnimationRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	var payload struct {
+		Files  []int  `json:"files"`
+		Format string `json:"format"`
+		Width  int64  `json:"width"`
+		Delay  int64  `json:"delay"` // milliseconds
+		Loop   *bool  `json:"loop"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse an animation")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if payload.Format == "" {
+		payload.Format = "gif"
+	}
+	format, ok := image.AnimationFormat(payload.Format)
+	if !ok {
+		jsonResponse(w, http.StatusBadRequest, errorMessage(errors.New(constants.STRINGS["animationOptionsInvalid"])))
+		return
+	}
+
+	options := image.AnimationOptions{
+		Format: format,
+		Width:  payload.Width,
+		Delay:  time.Duration(payload.Delay) * time.Millisecond,
+		Loop:   payload.Loop == nil || *payload.Loop,
+	}
+	status, file, err := appDB.CreateAnimation(payload.Files, options, userID, store, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(file)
+	jsonResponse(w, status, string(response))
+}
+
+func fetchFileSourcesRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("file"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, files := appDB.GetFileSources(fileID, userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	response, _ := json.Marshal(files)
+	jsonResponse(w, status, string(response))
+}
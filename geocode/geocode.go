@@ -0,0 +1,184 @@
+package geocode
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout stops waiting for a service which doesn't answer
+const requestTimeout = 10 * time.Second
+
+// defaultUserAgent identifies requests when no other is configured, Nominatim refuses
+// anonymous ones and asks for an agent telling the application and how to reach its admin
+const defaultUserAgent = "photos (self-hosted)"
+
+// cacheMaxSize caps names kept in memory, the cache starts over when it's full
+const cacheMaxSize = 10000
+
+// requestInterval spaces requests out, Nominatim allows one request per second
+var requestInterval = time.Second
+
+var serviceURL = ""
+var language = ""
+var userAgent = defaultUserAgent
+var client = &http.Client{Timeout: requestTimeout}
+
+// throttle serializes requests, lastRequest is when the previous one was sent
+var throttle sync.Mutex
+var lastRequest time.Time
+
+// cache keeps names of places by rounded coordinates, photos are mostly taken close to each other
+var cache = map[string]string{}
+var cacheLock sync.Mutex
+
+// address is a part of a Nominatim reverse response. Only one of the localities is set
+type address struct {
+	City         string `json:"city"`
+	Town         string `json:"town"`
+	Village      string `json:"village"`
+	Municipality string `json:"municipality"`
+	State        string `json:"state"`
+	Country      string `json:"country"`
+}
+
+type reverseResponse struct {
+	DisplayName string  `json:"display_name"`
+	Address     address `json:"address"`
+	Error       string  `json:"error"`
+}
+
+// Configure sets the URL of a Nominatim compatible service, the language of place names and
+// the User-Agent of requests. An empty URL turns geocoding off, an empty language leaves it
+// to the service and an empty agent is the default one
+func Configure(service, placeLanguage, agent string) {
+	serviceURL = strings.TrimSuffix(service, "/")
+	language = placeLanguage
+	userAgent = agent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+
+	cacheLock.Lock()
+	cache = map[string]string{}
+	cacheLock.Unlock()
+}
+
+// Enabled tells whether a service is configured
+func Enabled() bool {
+	return serviceURL != ""
+}
+
+// placeName joins the locality, the region and the country, e.g. `Lisbon, Lisbon, Portugal`
+// is shortened to `Lisbon, Portugal`. The full name is used when the address is unknown
+func placeName(response reverseResponse) string {
+	parts := []string{}
+	for _, part := range []string{
+		response.Address.City,
+		response.Address.Town,
+		response.Address.Village,
+		response.Address.Municipality,
+		response.Address.State,
+		response.Address.Country,
+	} {
+		if part != "" && (len(parts) == 0 || parts[len(parts)-1] != part) {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return response.DisplayName
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// cacheKey rounds the coordinates to about a kilometer, places are named by cities
+func cacheKey(latitude, longitude float64) string {
+	return strconv.FormatFloat(latitude, 'f', 2, 64) + "," + strconv.FormatFloat(longitude, 'f', 2, 64)
+}
+
+// wait blocks until the next request can be sent
+func wait() {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	if delay := requestInterval - time.Since(lastRequest); delay > 0 {
+		time.Sleep(delay)
+	}
+	lastRequest = time.Now()
+}
+
+// Reverse returns the name of the place at the coordinates. It's empty when geocoding is off
+// or the service knows no place there, e.g. in the middle of an ocean. Requests are sent one
+// at a time at most once per requestInterval, names of places close to each other are cached
+func Reverse(latitude, longitude float64) (string, error) {
+	if !Enabled() {
+		return "", nil
+	}
+
+	key := cacheKey(latitude, longitude)
+	cacheLock.Lock()
+	place, ok := cache[key]
+	cacheLock.Unlock()
+	if ok {
+		return place, nil
+	}
+
+	place, err := request(latitude, longitude)
+	if err != nil {
+		return "", err
+	}
+
+	cacheLock.Lock()
+	if len(cache) >= cacheMaxSize {
+		cache = map[string]string{}
+	}
+	cache[key] = place
+	cacheLock.Unlock()
+
+	return place, nil
+}
+
+// request asks the service for the name of the place at the coordinates
+func request(latitude, longitude float64) (string, error) {
+	query := url.Values{}
+	query.Set("format", "jsonv2")
+	query.Set("lat", strconv.FormatFloat(latitude, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(longitude, 'f', -1, 64))
+	query.Set("zoom", "10")
+	if language != "" {
+		query.Set("accept-language", language)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, serviceURL+"/reverse?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	wait()
+	response, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geocoding failed with status %d", response.StatusCode)
+	}
+
+	var place reverseResponse
+	if err := json.NewDecoder(response.Body).Decode(&place); err != nil {
+		return "", err
+	}
+	if place.Error != "" {
+		return "", nil
+	}
+
+	return placeName(place), nil
+}
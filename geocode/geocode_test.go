@@ -0,0 +1,103 @@
+package geocode
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPlaceName(t *testing.T) {
+	cases := []struct {
+		response reverseResponse
+		name     string
+	}{
+		{reverseResponse{Address: address{City: "Lisbon", State: "Lisbon", Country: "Portugal"}}, "Lisbon, Portugal"},
+		{reverseResponse{Address: address{Village: "Zakopane", State: "Lesser Poland", Country: "Poland"}}, "Zakopane, Lesser Poland, Poland"},
+		{reverseResponse{DisplayName: "Atlantic Ocean"}, "Atlantic Ocean"},
+		{reverseResponse{}, ""},
+	}
+
+	for _, c := range cases {
+		if name := placeName(c.response); name != c.name {
+			t.Errorf("placeName(%+v) = %q; want `%q`", c.response, name, c.name)
+		}
+	}
+}
+
+func TestReverse(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		if r.URL.Path != "/reverse" || r.Header.Get("User-Agent") != "photos-test (admin@example.com)" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if query.Get("lat") == "0" {
+			w.Write([]byte(`{"error": "Unable to geocode"}`))
+			return
+		}
+		if query.Get("lat") != "38.7139" || query.Get("lon") != "-9.1394" || query.Get("accept-language") != "en" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{"display_name": "Lisboa", "address": {"city": "Lisbon", "country": "Portugal"}}`))
+	}))
+	defer server.Close()
+
+	defer func(interval time.Duration) { requestInterval = interval }(requestInterval)
+	requestInterval = 0
+
+	Configure("", "", "")
+	if place, err := Reverse(38.7139, -9.1394); place != "" || err != nil {
+		t.Errorf("Reverse = %q, %v; want nothing - geocoding is off", place, err)
+	}
+
+	Configure(server.URL+"/", "en", "photos-test (admin@example.com)")
+	defer Configure("", "", "")
+
+	place, err := Reverse(38.7139, -9.1394)
+	if err != nil || place != "Lisbon, Portugal" {
+		t.Errorf("Reverse = %q, %v; want `Lisbon, Portugal`", place, err)
+	}
+
+	// A place nearby is cached, the server would refuse other coordinates
+	place, err = Reverse(38.7141, -9.1392)
+	if err != nil || place != "Lisbon, Portugal" || requests != 1 {
+		t.Errorf("Reverse = %q, %v after %d requests; want `Lisbon, Portugal` from the cache", place, err, requests)
+	}
+
+	place, err = Reverse(0, 0)
+	if err != nil || place != "" {
+		t.Errorf("Reverse = %q, %v; want nothing - unknown place", place, err)
+	}
+
+	Configure(server.URL+"/missing", "en", "photos-test (admin@example.com)")
+	if _, err := Reverse(38.7139, -9.1394); err == nil {
+		t.Error("Reverse - want an error of a failed request")
+	}
+}
+
+func TestReverseThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"address": {"city": "Lisbon", "country": "Portugal"}}`))
+	}))
+	defer server.Close()
+
+	defer func(interval time.Duration) { requestInterval = interval }(requestInterval)
+	requestInterval = 50 * time.Millisecond
+	Configure(server.URL, "", "")
+	defer Configure("", "", "")
+
+	start := time.Now()
+	for _, latitude := range []float64{10, 20, 30} {
+		if _, err := Reverse(latitude, 0); err != nil {
+			t.Fatalf("Reverse - error: %s", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 2*requestInterval {
+		t.Errorf("Reverse - 3 requests took %s; want at least `%s`", elapsed, 2*requestInterval)
+	}
+}
@@ -0,0 +1,215 @@
+package image
+
+import (
+	"errors"
+	"time"
+
+	model "photos/model"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// ErrInvalidColor is returned when ImageMagick doesn't understand a background color
+var ErrInvalidColor = errors.New("invalid color")
+
+var gifFormat = Format{"GIF", "gif", "image/gif", 0}
+
+// animationFormats are formats in which animations can be generated
+var animationFormats = map[string]Format{
+	"gif":  gifFormat,
+	"webp": webpFormat,
+}
+
+// CollageLayout describes a grid of square cells. Background is any color ImageMagick
+// understands, e.g. `white` or `#1e1e1e`
+type CollageLayout struct {
+	Columns    int
+	CellSize   int64
+	Spacing    int64
+	Background string
+}
+
+// AnimationOptions describe a generated animation. Frames are scaled to the width
+type AnimationOptions struct {
+	Format Format
+	Width  int64
+	Delay  time.Duration
+	Loop   bool
+}
+
+// Source is an image a collage or an animation is made of, it's shown rotated and edited
+// as the user did
+type Source struct {
+	Data     []byte
+	Rotation int64
+	Edits    []model.Edit
+}
+
+// AnimationFormat returns an animation format by its name, `gif` or `webp`
+func AnimationFormat(name string) (Format, bool) {
+	format, ok := animationFormats[name]
+
+	return format, ok
+}
+
+// orientedFrame reads the first frame of the image and rotates it as its EXIF orientation says,
+// the orientation is lost when the image is composed with others
+func orientedFrame(image []byte) (*imagick.MagickWand, error) {
+	mw, err := firstFrame(image)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mw.AutoOrientImage(); err != nil {
+		mw.Destroy()
+
+		return nil, err
+	}
+
+	return mw, nil
+}
+
+// fitHeight scales the image down so it isn't higher than the height
+func fitHeight(mw *imagick.MagickWand, height int64) error {
+	w, h := int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+	if h <= height {
+		return nil
+	}
+
+	return mw.ResizeImage(uint(w*height/h), uint(height), imagick.FILTER_LANCZOS)
+}
+
+// Collage composes images to a grid, row by row in the given order. Every image is cropped
+// to a square cell, cells are separated by the spacing filled with the background
+func Collage(images []Source, layout CollageLayout) (RenderedImage, error) {
+	background := imagick.NewPixelWand()
+	defer background.Destroy()
+	if !background.SetColor(layout.Background) {
+		return RenderedImage{}, ErrInvalidColor
+	}
+
+	columns := int64(layout.Columns)
+	rows := (int64(len(images)) + columns - 1) / columns
+	width := columns*layout.CellSize + (columns+1)*layout.Spacing
+	height := rows*layout.CellSize + (rows+1)*layout.Spacing
+
+	canvas := imagick.NewMagickWand()
+	defer canvas.Destroy()
+	if err := canvas.NewImage(uint(width), uint(height), background); err != nil {
+		return RenderedImage{}, err
+	}
+
+	cell := Rendition{Width: layout.CellSize, Square: true}
+	for i, source := range images {
+		mw, err := editedFrame(source.Data, source.Rotation, source.Edits)
+		if err == nil {
+			err = resize(mw, cell)
+		}
+		if err != nil {
+			if mw != nil {
+				mw.Destroy()
+			}
+
+			return RenderedImage{}, err
+		}
+
+		// Images smaller than the cell are centered in it
+		column, row := int64(i)%columns, int64(i)/columns
+		x := layout.Spacing + column*(layout.CellSize+layout.Spacing) + (layout.CellSize-int64(mw.GetImageWidth()))/2
+		y := layout.Spacing + row*(layout.CellSize+layout.Spacing) + (layout.CellSize-int64(mw.GetImageHeight()))/2
+		err = canvas.CompositeImage(mw, imagick.COMPOSITE_OP_OVER, true, int(x), int(y))
+		mw.Destroy()
+		if err != nil {
+			return RenderedImage{}, err
+		}
+	}
+
+	if err := canvas.SetImageFormat(jpegFormat.Name); err != nil {
+		return RenderedImage{}, err
+	}
+	if err := canvas.SetImageCompressionQuality(jpegFormat.Quality); err != nil {
+		return RenderedImage{}, err
+	}
+
+	return RenderedImage{
+		Format: jpegFormat,
+		Width:  width,
+		Height: height,
+		Data:   canvas.GetImageBlob(),
+	}, nil
+}
+
+// Animate makes an animation of images, e.g. a burst sequence, in the given order. Frames
+// are scaled to the width and centered on a canvas of the first frame's size
+func Animate(images []Source, options AnimationOptions) (RenderedImage, error) {
+	background := imagick.NewPixelWand()
+	defer background.Destroy()
+	background.SetColor("black")
+
+	animation := imagick.NewMagickWand()
+	defer animation.Destroy()
+
+	// GIF delays are in hundredths of a second
+	delay := uint(options.Delay / (10 * time.Millisecond))
+	iterations := uint(1)
+	if options.Loop {
+		iterations = 0
+	}
+
+	var width, height int64
+	for i, source := range images {
+		mw, err := editedFrame(source.Data, source.Rotation, source.Edits)
+		if err == nil {
+			err = resize(mw, Rendition{Width: options.Width})
+		}
+		if err == nil && i == 0 {
+			width, height = int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+		}
+		if err == nil && i > 0 {
+			err = fitHeight(mw, height)
+		}
+		if err == nil {
+			err = mw.SetImageBackgroundColor(background)
+		}
+		if err == nil {
+			w, h := int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+			err = mw.ExtentImage(uint(width), uint(height), -int((width-w)/2), -int((height-h)/2))
+		}
+		if err == nil {
+			err = mw.StripImage()
+		}
+		if err == nil {
+			err = mw.SetImageDelay(delay)
+		}
+		if err == nil {
+			err = mw.SetImageIterations(iterations)
+		}
+		if err == nil {
+			err = animation.AddImage(mw)
+		}
+
+		if mw != nil {
+			mw.Destroy()
+		}
+		if err != nil {
+			return RenderedImage{}, err
+		}
+	}
+
+	animation.ResetIterator()
+	if err := animation.SetFormat(options.Format.Name); err != nil {
+		return RenderedImage{}, err
+	}
+	if options.Format.Quality > 0 {
+		if err := animation.SetImageCompressionQuality(options.Format.Quality); err != nil {
+			return RenderedImage{}, err
+		}
+	}
+
+	return RenderedImage{
+		Format: options.Format,
+		Width:  width,
+		Height: height,
+		Data:   animation.GetImagesBlob(),
+	}, nil
+}
@@ -0,0 +1,201 @@
+package image
+
+import (
+	"math"
+
+	model "photos/model"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// Operations of the edit stack
+const (
+	EditCrop       = "crop"
+	EditRotate     = "rotate"
+	EditStraighten = "straighten"
+	EditAdjust     = "adjust"
+	EditFilter     = "filter"
+)
+
+// maxStraightenAngle limits straightening, a larger tilt is a rotation
+const maxStraightenAngle = 45
+
+// maxAdjustment limits brightness, contrast and saturation changes in percents
+const maxAdjustment = 100
+
+// filters are preset looks applied by the filter operation
+var filters = map[string]func(mw *imagick.MagickWand) error{
+	"mono": func(mw *imagick.MagickWand) error {
+		return mw.ModulateImage(100, 0, 100)
+	},
+	"sepia": func(mw *imagick.MagickWand) error {
+		_, quantum := imagick.GetQuantumRange()
+
+		return mw.SepiaToneImage(0.8 * float64(quantum))
+	},
+	"vivid": func(mw *imagick.MagickWand) error {
+		if err := mw.ModulateImage(100, 130, 100); err != nil {
+			return err
+		}
+
+		return mw.BrightnessContrastImage(0, 10)
+	},
+	"fade": func(mw *imagick.MagickWand) error {
+		if err := mw.ModulateImage(100, 80, 100); err != nil {
+			return err
+		}
+
+		return mw.BrightnessContrastImage(10, -20)
+	},
+}
+
+func inRange(value, limit float64) bool {
+	return value >= -limit && value <= limit
+}
+
+// ValidEdit checks that the edit is a known operation with values in their ranges
+func ValidEdit(edit model.Edit) bool {
+	switch edit.Operation {
+	case EditCrop:
+		return edit.X >= 0 && edit.Y >= 0 && edit.Width > 0 && edit.Height > 0 &&
+			edit.X+edit.Width <= 1 && edit.Y+edit.Height <= 1
+	case EditRotate:
+		return edit.Degrees%90 == 0
+	case EditStraighten:
+		return inRange(edit.Angle, maxStraightenAngle)
+	case EditAdjust:
+		return inRange(edit.Brightness, maxAdjustment) &&
+			inRange(edit.Contrast, maxAdjustment) &&
+			inRange(edit.Saturation, maxAdjustment)
+	case EditFilter:
+		return filters[edit.Filter] != nil
+	}
+
+	return false
+}
+
+// cropBox converts the crop box to pixels of an image of the size. It's at least a pixel
+func cropBox(width, height int64, edit model.Edit) (int64, int64, int64, int64) {
+	x, y := int64(edit.X*float64(width)), int64(edit.Y*float64(height))
+	w, h := int64(math.Round(edit.Width*float64(width))), int64(math.Round(edit.Height*float64(height)))
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	if x+w > width {
+		x = width - w
+	}
+	if y+h > height {
+		y = height - h
+	}
+
+	return w, h, x, y
+}
+
+// straightenedSize returns the largest size of the image's aspect ratio which fits inside
+// the image rotated by the angle, so straightening leaves no blank corners
+func straightenedSize(width, height int64, angle float64) (int64, int64) {
+	radians := math.Abs(angle) * math.Pi / 180
+	sin, cos := math.Sin(radians), math.Cos(radians)
+	w, h := float64(width), float64(height)
+	scale := math.Min(w/(w*cos+h*sin), h/(w*sin+h*cos))
+
+	return int64(math.Max(1, math.Floor(w*scale))), int64(math.Max(1, math.Floor(h*scale)))
+}
+
+// EditedDimensions returns the size of an image of the width and height after the edits
+func EditedDimensions(width, height int64, edits []model.Edit) (int64, int64) {
+	for _, edit := range edits {
+		switch edit.Operation {
+		case EditCrop:
+			width, height, _, _ = cropBox(width, height, edit)
+		case EditRotate:
+			if edit.Degrees%180 != 0 {
+				width, height = height, width
+			}
+		case EditStraighten:
+			width, height = straightenedSize(width, height, edit.Angle)
+		}
+	}
+
+	return width, height
+}
+
+// applyEdit changes the image by the edit
+func applyEdit(mw *imagick.MagickWand, edit model.Edit) error {
+	width, height := int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+
+	switch edit.Operation {
+	case EditCrop:
+		w, h, x, y := cropBox(width, height, edit)
+		if err := mw.CropImage(uint(w), uint(h), int(x), int(y)); err != nil {
+			return err
+		}
+
+		return mw.SetImagePage(uint(w), uint(h), 0, 0)
+	case EditRotate:
+		return rotate(mw, edit.Degrees)
+	case EditStraighten:
+		if edit.Angle == 0 {
+			return nil
+		}
+
+		background := imagick.NewPixelWand()
+		defer background.Destroy()
+		background.SetColor("none")
+		if err := mw.RotateImage(background, edit.Angle); err != nil {
+			return err
+		}
+
+		// The rotated image grows to fit the corners, its center is kept
+		w, h := straightenedSize(width, height, edit.Angle)
+		rotatedWidth, rotatedHeight := int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+		if err := mw.CropImage(uint(w), uint(h), int((rotatedWidth-w)/2), int((rotatedHeight-h)/2)); err != nil {
+			return err
+		}
+
+		return mw.SetImagePage(uint(w), uint(h), 0, 0)
+	case EditAdjust:
+		if edit.Brightness != 0 || edit.Contrast != 0 {
+			if err := mw.BrightnessContrastImage(edit.Brightness, edit.Contrast); err != nil {
+				return err
+			}
+		}
+		if edit.Saturation != 0 {
+			return mw.ModulateImage(100, 100+edit.Saturation, 100)
+		}
+
+		return nil
+	case EditFilter:
+		return filters[edit.Filter](mw)
+	}
+
+	return nil
+}
+
+// editedFrame reads the first frame of the image upright as its EXIF orientation says,
+// rotated by the user and changed by the edits in their order
+func editedFrame(image []byte, rotation int64, edits []model.Edit) (*imagick.MagickWand, error) {
+	mw, err := orientedFrame(image)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rotate(mw, rotation)
+	for _, edit := range edits {
+		if err != nil {
+			break
+		}
+
+		err = applyEdit(mw, edit)
+	}
+	if err != nil {
+		mw.Destroy()
+
+		return nil, err
+	}
+
+	return mw, nil
+}
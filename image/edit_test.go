@@ -0,0 +1,54 @@
+package image
+
+import (
+	"testing"
+
+	model "photos/model"
+)
+
+func TestValidEdit(t *testing.T) {
+	cases := []struct {
+		edit model.Edit
+		want bool
+	}{
+		{model.Edit{Operation: EditCrop, X: 0.25, Y: 0, Width: 0.75, Height: 1}, true},
+		{model.Edit{Operation: EditCrop, X: 0.5, Width: 0.6, Height: 1}, false},
+		{model.Edit{Operation: EditCrop, Width: 0, Height: 1}, false},
+		{model.Edit{Operation: EditRotate, Degrees: -90}, true},
+		{model.Edit{Operation: EditRotate, Degrees: 45}, false},
+		{model.Edit{Operation: EditStraighten, Angle: -12.5}, true},
+		{model.Edit{Operation: EditStraighten, Angle: 60}, false},
+		{model.Edit{Operation: EditAdjust, Brightness: 20, Contrast: -100, Saturation: 5}, true},
+		{model.Edit{Operation: EditAdjust, Saturation: 150}, false},
+		{model.Edit{Operation: EditFilter, Filter: "sepia"}, true},
+		{model.Edit{Operation: EditFilter, Filter: "unknown"}, false},
+		{model.Edit{Operation: "blur"}, false},
+	}
+
+	for _, c := range cases {
+		if got := ValidEdit(c.edit); got != c.want {
+			t.Errorf("ValidEdit(%+v) = %t; want `%t`", c.edit, got, c.want)
+		}
+	}
+}
+
+func TestEditedDimensions(t *testing.T) {
+	edits := []model.Edit{
+		{Operation: EditCrop, X: 0.5, Y: 0.25, Width: 0.5, Height: 0.5},
+		{Operation: EditRotate, Degrees: 90},
+		{Operation: EditFilter, Filter: "mono"},
+	}
+	if w, h := EditedDimensions(4000, 3000, edits); w != 1500 || h != 2000 {
+		t.Errorf("EditedDimensions = %dx%d; want `%dx%d`", w, h, 1500, 2000)
+	}
+
+	// A square straightened by 45 degrees fits inside itself scaled by 1/sqrt(2)
+	straighten := []model.Edit{{Operation: EditStraighten, Angle: -45}}
+	if w, h := EditedDimensions(1000, 1000, straighten); w != 707 || h != 707 {
+		t.Errorf("EditedDimensions = %dx%d; want `%dx%d` - straightened", w, h, 707, 707)
+	}
+
+	if w, h := EditedDimensions(10, 10, []model.Edit{{Operation: EditCrop, Width: 0.01, Height: 0.01}}); w != 1 || h != 1 {
+		t.Errorf("EditedDimensions = %dx%d; want `%dx%d` - at least a pixel", w, h, 1, 1)
+	}
+}
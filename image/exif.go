@@ -2,148 +2,391 @@ package image
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	stdimage "image"
+	"math"
 	"strconv"
 	"strings"
 
+	// Decoders of formats whose dimensions are read when EXIF lacks them
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
 	model "photos/model"
 
 	"github.com/h2non/filetype"
 	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
 	"gopkg.in/guregu/null.v3"
 )
 
-type exifFields struct {
-	ApertureValue                    []string `json:"ApertureValue"`
-	BrightnessValue                  []string `json:"BrightnessValue"`
-	ColorSpace                       []int    `json:"ColorSpace"`
-	ComponentsConfiguration          string   `json:"ComponentsConfiguration"`
-	CompressedBitsPerPixel           []string `json:"CompressedBitsPerPixel"`
-	Copyright                        string   `json:"Copyright"`
-	CustomRendered                   []int    `json:"CustomRendered"`
-	DateTime                         string   `json:"DateTime"`
-	DateTimeDigitized                string   `json:"DateTimeDigitized"`
-	DateTimeOriginal                 string   `json:"DateTimeOriginal"`
-	ExifIFDPointer                   []int    `json:"ExifIFDPointer"`
-	ExifVersion                      string   `json:"ExifVersion"`
-	ExposureBiasValue                []string `json:"ExposureBiasValue"`
-	ExposureMode                     []int    `json:"ExposureMode"`
-	ExposureProgram                  []int    `json:"ExposureProgram"`
-	ExposureTime                     []string `json:"ExposureTime"`
-	FNumber                          []string `json:"FNumber"`
-	FileSource                       string   `json:"FileSource"`
-	Flash                            []int    `json:"Flash"`
-	FlashpixVersion                  string   `json:"FlashpixVersion"`
-	FocalLength                      []string `json:"FocalLength"`
-	FocalPlaneResolutionUnit         []int    `json:"FocalPlaneResolutionUnit"`
-	FocalPlaneXResolution            []string `json:"FocalPlaneXResolution"`
-	FocalPlaneYResolution            []string `json:"FocalPlaneYResolution"`
-	ISOSpeedRatings                  []int    `json:"ISOSpeedRatings"`
-	InteroperabilityIFDPointer       []int    `json:"InteroperabilityIFDPointer"`
-	InteroperabilityIndex            string   `json:"InteroperabilityIndex"`
-	LightSource                      []int    `json:"LightSource"`
-	Make                             string   `json:"Make"`
-	MakerNote                        string   `json:"MakerNote"`
-	MaxApertureValue                 []string `json:"MaxApertureValue"`
-	MeteringMode                     []int    `json:"MeteringMode"`
-	Model                            string   `json:"Model"`
-	Orientation                      []int    `json:"Orientation"`
-	PixelXDimension                  []int    `json:"PixelXDimension"`
-	PixelYDimension                  []int    `json:"PixelYDimension"`
-	ResolutionUnit                   []int    `json:"ResolutionUnit"`
-	SceneCaptureType                 []int    `json:"SceneCaptureType"`
-	SceneType                        string   `json:"SceneType"`
-	SensingMethod                    []int    `json:"SensingMethod"`
-	Sharpness                        []int    `json:"Sharpness"`
-	ShutterSpeedValue                []string `json:"ShutterSpeedValue"`
-	Software                         string   `json:"Software"`
-	SubjectDistanceRange             []int    `json:"SubjectDistanceRange"`
-	ThumbJPEGInterchangeFormat       []int    `json:"ThumbJPEGInterchangeFormat"`
-	ThumbJPEGInterchangeFormatLength []int    `json:"ThumbJPEGInterchangeFormatLength"`
-	WhiteBalance                     []int    `json:"WhiteBalance"`
-	XResolution                      []string `json:"XResolution"`
-	YCbCrPositioning                 []int    `json:"YCbCrPositioning"`
-	YResolution                      []string `json:"YResolution"`
+// tagInt reads the first value of an integer tag. A missing or malformed tag is null
+func tagInt(x *exif.Exif, name exif.FieldName) null.Int {
+	tag, err := x.Get(name)
+	if err != nil || tag.Count == 0 {
+		return null.Int{}
+	}
+
+	value, err := tag.Int(0)
+	if err != nil {
+		return null.Int{}
+	}
+
+	return null.IntFrom(int64(value))
+}
+
+// whiteBalances are names of WhiteBalance values
+var whiteBalances = map[int64]string{0: "auto", 1: "manual"}
+
+// meteringModes are names of MeteringMode values
+var meteringModes = map[int64]string{
+	1:   "average",
+	2:   "centerWeighted",
+	3:   "spot",
+	4:   "multiSpot",
+	5:   "pattern",
+	6:   "partial",
+	255: "other",
+}
+
+// tagName maps an integer tag to the name of its value. Unknown values are null
+func tagName(x *exif.Exif, name exif.FieldName, names map[int64]string) null.String {
+	value := tagInt(x, name)
+	if !value.Valid || names[value.Int64] == "" {
+		return null.String{}
+	}
+
+	return null.StringFrom(names[value.Int64])
+}
+
+// tagRational reads the first value of a rational tag. It's false when the tag is
+// missing, malformed or its denominator is zero
+func tagRational(x *exif.Exif, name exif.FieldName) (int64, int64, bool) {
+	tag, err := x.Get(name)
+	if err != nil || tag.Count == 0 {
+		return 0, 0, false
+	}
+
+	numerator, denominator, err := tag.Rat2(0)
+	if err != nil || denominator == 0 {
+		return 0, 0, false
+	}
+
+	return numerator, denominator, true
+}
+
+// tagFloat reads the first value of a rational tag as a number
+func tagFloat(x *exif.Exif, name exif.FieldName) null.Float {
+	numerator, denominator, ok := tagRational(x, name)
+	if !ok {
+		return null.Float{}
+	}
+
+	return null.FloatFrom(float64(numerator) / float64(denominator))
 }
 
-func parseValues(val []string) (float64, float64) {
-	values := strings.Split(val[0], "/")
-	first, err := strconv.ParseFloat(values[0], 32)
-	second, err := strconv.ParseFloat(values[1], 32)
+// tagString reads an ASCII tag. Cameras pad values with spaces and NULs, an empty value is null
+func tagString(x *exif.Exif, name exif.FieldName) null.String {
+	tag, err := x.Get(name)
 	if err != nil {
-		fmt.Println("Can't parse values: ", val, err)
-		return 0, 0
+		return null.String{}
+	}
+
+	value, err := tag.StringVal()
+	value = strings.TrimSpace(strings.Trim(value, "\x00"))
+	if err != nil || value == "" {
+		return null.String{}
+	}
+
+	return null.StringFrom(value)
+}
+
+// exposureTime formats the exposure as photographers write it: `1/250` for fractions
+// of a second, `2` or `2.5` for longer exposures
+func exposureTime(x *exif.Exif) null.String {
+	numerator, denominator, ok := tagRational(x, exif.ExposureTime)
+	if !ok || numerator <= 0 {
+		return null.String{}
+	}
+
+	if numerator >= denominator {
+		seconds := float64(numerator) / float64(denominator)
+
+		return null.StringFrom(strconv.FormatFloat(seconds, 'f', -1, 64))
 	}
 
-	return first, second
+	return null.StringFrom(fmt.Sprintf("1/%d", int64(math.Round(float64(denominator)/float64(numerator)))))
 }
 
-func convertToFloat(val []string) null.Float {
-	first, second := parseValues(val)
+// positive keeps only values greater than zero, cameras write zeroes for unknown values
+func positive(value null.Int) null.Int {
+	if value.Valid && value.Int64 <= 0 {
+		return null.Int{}
+	}
 
-	return null.FloatFrom(float64(first / second))
+	return value
 }
 
-func convertToInt(val int) null.Int {
-	return null.IntFrom(int64(val))
+// decodeDimensions reads width and height from the image header. Only formats
+// with a Go decoder are supported, the others stay null
+func decodeDimensions(data []byte) (null.Int, null.Int) {
+	config, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return null.Int{}, null.Int{}
+	}
+
+	return null.IntFrom(int64(config.Width)), null.IntFrom(int64(config.Height))
 }
 
-func parseExposureTime(val []string) null.String {
-	x, y := parseValues(val)
-	if x == 0 || y == 0 {
-		return null.StringFrom("")
+var exifHeader = []byte("Exif\x00\x00")
+
+// tiffBlock finds TIFF structure holding EXIF the same way the decoder does: a TIFF file
+// is the block itself, in JPEG it's in the first APP1 segment. Nil when there's none
+func tiffBlock(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return data
+	case bytes.HasPrefix(data, exifHeader):
+		return data[len(exifHeader):]
 	}
 
-	var second uint
-	if int(y) == 1 {
-		second = uint(x)
+	for i := 0; i < len(data); {
+		index := bytes.IndexByte(data[i:], 0xff)
+		if index < 0 || i+index+1 >= len(data) {
+			return nil
+		}
+
+		marker := data[i+index+1]
+		i += index + 2
+		if marker != 0xe1 {
+			continue
+		}
+
+		if i+2 > len(data) {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i:])) - 2
+		i += 2
+		if length == 0 {
+			continue
+		}
+		if length < 0 || i+length > len(data) || !bytes.HasPrefix(data[i:i+length], exifHeader) {
+			return nil
+		}
+
+		return data[i+len(exifHeader) : i+length]
+	}
+
+	return nil
+}
+
+// rawExif collects every tag as JSON. Values which the decoder can't encode, e.g. strings
+// with quotes, are kept as text. NULs are dropped, Postgres doesn't store them in JSON
+type rawExif map[string]interface{}
+
+func (raw rawExif) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	value, err := tag.MarshalJSON()
+	if err == nil && json.Valid(value) && !bytes.Contains(value, []byte(`\u0000`)) {
+		raw[string(name)] = json.RawMessage(value)
 	} else {
-		second = uint(y / x)
+		raw[string(name)] = strings.ToValidUTF8(strings.ReplaceAll(string(tag.Val), "\x00", ""), "")
+	}
+
+	return nil
+}
+
+// typeSizes are sizes in bytes of TIFF value types by their number
+var typeSizes = map[uint16]uint64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// subIFDTags point to IFDs which the decoder reads besides the chain: EXIF, GPS and interoperability
+var subIFDTags = map[uint16]bool{0x8769: true, 0x8825: true, 0xa005: true}
+
+// checkIFD reads entries of the IFD at the offset. It returns the offset of the next IFD,
+// offsets of sub-IFDs and false when a size of an entry doesn't fit 32 bits. An IFD out
+// of the block ends the walk, the decoder fails on it by itself
+func checkIFD(block []byte, offset uint32, order binary.ByteOrder) (uint32, []uint32, bool) {
+	subIFDs := []uint32{}
+	if int64(offset)+2 > int64(len(block)) {
+		return 0, subIFDs, true
+	}
+
+	// Every entry has 12 bytes, the offset of the next IFD follows them
+	count := int64(int16(order.Uint16(block[offset:])))
+	for i := int64(0); i < count; i++ {
+		position := int64(offset) + 2 + 12*i
+		if position+12 > int64(len(block)) {
+			return 0, subIFDs, true
+		}
+
+		entry := block[position : position+12]
+		tag, valueType, valuesCount := order.Uint16(entry), order.Uint16(entry[2:]), order.Uint32(entry[4:])
+		if typeSizes[valueType]*uint64(valuesCount) > math.MaxUint32 {
+			return 0, subIFDs, false
+		}
+
+		switch {
+		case subIFDTags[tag] && valueType == 4 && valuesCount > 0:
+			subIFDs = append(subIFDs, order.Uint32(entry[8:]))
+		case subIFDTags[tag] && valueType == 3 && valuesCount > 0:
+			subIFDs = append(subIFDs, uint32(order.Uint16(entry[8:])))
+		}
+	}
+
+	next := int64(offset) + 2 + 12*count
+	if count < 0 {
+		next = int64(offset) + 2
+	}
+	if next+4 > int64(len(block)) {
+		return 0, subIFDs, true
+	}
+
+	return order.Uint32(block[next:]), subIFDs, true
+}
+
+// validIFDs rejects IFD offsets and counts which send the EXIF decoder into an infinite
+// loop or an out-of-range read. The decoder follows a chain of IFDs linking back to an
+// earlier one forever, it catches only an IFD linking to itself. A count of values whose
+// size overflows 32 bits wraps around, so the decoder reads values past the block
+func validIFDs(block []byte) bool {
+	if len(block) < 8 {
+		return true
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if block[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	visited := map[uint32]bool{}
+	pending := []uint32{}
+	for offset := order.Uint32(block[4:]); offset != 0; {
+		if visited[offset] {
+			return false
+		}
+		visited[offset] = true
+
+		next, subIFDs, ok := checkIFD(block, offset, order)
+		if !ok {
+			return false
+		}
+
+		pending = append(pending, subIFDs...)
+		offset = next
+	}
+
+	for len(pending) > 0 {
+		offset := pending[0]
+		pending = pending[1:]
+		if visited[offset] {
+			continue
+		}
+		visited[offset] = true
+
+		_, subIFDs, ok := checkIFD(block, offset, order)
+		if !ok {
+			return false
+		}
+
+		pending = append(pending, subIFDs...)
+	}
+
+	return true
+}
+
+// readExif fills the file from EXIF of the content. The decoder panics on some malformed
+// blocks, e.g. when a tag has fewer values than it declares, that's turned into an error
+func readExif(data []byte, file *model.File) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed EXIF: %v", r)
+		}
+	}()
+
+	if !validIFDs(tiffBlock(data)) {
+		return errors.New("malformed EXIF: invalid IFD structure")
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	file.Camera = tagString(x, exif.Make)
+	file.Model = tagString(x, exif.Model)
+	file.ExposureTime = exposureTime(x)
+	file.FNumber = tagFloat(x, exif.FNumber)
+	file.FocalLength = tagFloat(x, exif.FocalLength)
+	file.Iso = positive(tagInt(x, exif.ISOSpeedRatings))
+	file.Width = positive(tagInt(x, exif.PixelXDimension))
+	file.Height = positive(tagInt(x, exif.PixelYDimension))
+
+	if orientation := tagInt(x, exif.Orientation); orientation.Int64 >= 1 && orientation.Int64 <= 8 {
+		file.Orientation = orientation
+	}
+
+	file.LensMake = tagString(x, exif.LensMake)
+	file.LensModel = tagString(x, exif.LensModel)
+	file.Software = tagString(x, exif.Software)
+	file.Copyright = tagString(x, exif.Copyright)
+	file.WhiteBalance = tagName(x, exif.WhiteBalance, whiteBalances)
+	file.MeteringMode = tagName(x, exif.MeteringMode, meteringModes)
+	file.ExposureBias = tagFloat(x, exif.ExposureBiasValue)
+
+	// The lowest bit tells whether the flash fired, the others describe its mode
+	if flash := tagInt(x, exif.Flash); flash.Valid {
+		file.Flash = null.BoolFrom(flash.Int64&1 == 1)
+	}
+
+	raw := rawExif{}
+	if err := x.Walk(raw); err == nil && len(raw) > 0 {
+		if encoded, err := json.Marshal(raw); err == nil {
+			file.RawExif = null.StringFrom(string(encoded))
+		}
+	}
+
+	if date, err := x.DateTime(); err == nil && !date.IsZero() {
+		file.Date = null.TimeFrom(date)
+	}
+
+	// 0,0 is what cameras without a GPS fix write
+	lat, long, err := x.LatLong()
+	if err == nil && (lat != 0 || long != 0) && !math.IsNaN(lat) && !math.IsNaN(long) {
+		file.Latitude = null.FloatFrom(lat)
+		file.Longitude = null.FloatFrom(long)
 	}
 
-	return null.StringFrom(fmt.Sprintf("%d/%d", int(x/x), second))
+	return nil
 }
 
-// ExtractExif extracts exif from file and returns File
+// ExtractExif reads metadata of the image: EXIF, XMP and IPTC. XMP takes precedence over
+// IPTC, it's what editors update. Missing or malformed tags are null, never zero.
+// Dimensions come from the image itself when EXIF lacks them, they are displayed ones,
+// swapped when the orientation turns the image on its side. The returned file holds
+// whatever could be read even when EXIF couldn't be decoded, the error only tells why
+// it's incomplete
 func ExtractExif(data []byte) (model.File, error) {
+	file := model.File{Size: null.IntFrom(int64(len(data)))}
+
 	kind, err := filetype.Match(data)
-	if kind == filetype.Unknown || err != nil {
-		fmt.Println("Unknown file type", err)
+	if err == nil && kind != filetype.Unknown {
+		file.Extension = null.StringFrom(kind.Extension)
+		file.MimeType = null.StringFrom(kind.MIME.Value)
 	}
 
-	file := bytes.NewReader(data)
-	fileExif, err := exif.Decode(file)
-	if err != nil {
-		return model.File{}, err
+	exifErr := readExif(data, &file)
+	readXMP(data, &file)
+	readIPTC(data, &file)
+
+	if !file.Width.Valid || !file.Height.Valid {
+		file.Width, file.Height = decodeDimensions(data)
+	}
+	if SwapsSides(file.Orientation.Int64, 0) {
+		file.Width, file.Height = file.Height, file.Width
 	}
 
-	var jsonExif exifFields
-	byteJSON, err := fileExif.MarshalJSON()
-	err = json.Unmarshal(byteJSON, &jsonExif)
-	if err != nil {
-		fmt.Println("Can't parse JSON EXIF. ", err)
-	}
-
-	dateTime, err := fileExif.DateTime()
-	long, lat, err := fileExif.LatLong()
-
-	return model.File{
-		Camera:       null.StringFrom(jsonExif.Make),
-		Date:         null.TimeFrom(dateTime),
-		ExposureTime: parseExposureTime(jsonExif.ExposureTime),
-		Extension:    null.StringFrom(kind.Extension),
-		FNumber:      convertToFloat(jsonExif.FNumber),
-		FocalLength:  convertToFloat(jsonExif.FocalLength),
-		Height:       convertToInt(jsonExif.PixelYDimension[0]),
-		Iso:          convertToInt(jsonExif.ISOSpeedRatings[0]),
-		Latitude:     null.FloatFrom(lat),
-		Longitude:    null.FloatFrom(long),
-		MimeType:     null.StringFrom(kind.MIME.Value),
-		Model:        null.StringFrom(jsonExif.Model),
-		Orientation:  convertToInt(jsonExif.Orientation[0]),
-		Owner:        convertToInt(1),
-		Size:         convertToInt(len(data)),
-		Width:        convertToInt(jsonExif.PixelXDimension[0]),
-	}, nil
+	return file, exifErr
 }
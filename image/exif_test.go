@@ -0,0 +1,209 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	stdimage "image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ifdEntry is a tag of IFD0 with a value which fits in the entry
+type ifdEntry struct {
+	tag    uint16
+	format uint16
+	count  uint32
+	value  [4]byte
+}
+
+func encodedImage(t testing.TB, format string) []byte {
+	var buf bytes.Buffer
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 12, 8))
+
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("Encode - error: %s", err)
+	}
+
+	return buf.Bytes()
+}
+
+// exifJPEG returns a JPEG with an APP1 segment holding IFD0 with the entries
+func exifJPEG(t testing.TB, entries []ifdEntry) []byte {
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("II*\x00")
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+	binary.Write(tiff, binary.LittleEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(tiff, binary.LittleEndian, entry.tag)
+		binary.Write(tiff, binary.LittleEndian, entry.format)
+		binary.Write(tiff, binary.LittleEndian, entry.count)
+		tiff.Write(entry.value[:])
+	}
+	binary.Write(tiff, binary.LittleEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	image := encodedImage(t, "jpeg")
+	result := append([]byte{}, image[:2]...)
+	result = append(result, app1...)
+	result = append(result, segment...)
+
+	return append(result, image[2:]...)
+}
+
+func TestExtractExifWithoutExif(t *testing.T) {
+	file, err := ExtractExif(encodedImage(t, "png"))
+	if err == nil {
+		t.Errorf("ExtractExif - PNG has no EXIF, expected an error")
+	}
+
+	if file.Width.Int64 != 12 || file.Height.Int64 != 8 {
+		t.Errorf("ExtractExif = %dx%d; want `%dx%d` - decoded dimensions", file.Width.Int64, file.Height.Int64, 12, 8)
+	}
+	if file.Latitude.Valid || file.Longitude.Valid || file.Orientation.Valid || file.Iso.Valid || file.Date.Valid {
+		t.Errorf("ExtractExif - missing tags should be null")
+	}
+}
+
+func TestExtractExif(t *testing.T) {
+	data := exifJPEG(t, []ifdEntry{
+		// Make, ASCII "Leica"
+		{0x010f, 2, 4, [4]byte{'L', 'e', 'i', 0}},
+		// Orientation, SHORT 6
+		{0x0112, 3, 1, [4]byte{6, 0, 0, 0}},
+	})
+
+	file, err := ExtractExif(data)
+	if err != nil {
+		t.Fatalf("ExtractExif - error: %s", err)
+	}
+
+	if file.Camera.String != "Lei" {
+		t.Errorf("ExtractExif - camera %q, expected %q", file.Camera.String, "Lei")
+	}
+	if file.Orientation.Int64 != 6 {
+		t.Errorf("ExtractExif - orientation %d, expected %d", file.Orientation.Int64, 6)
+	}
+	if file.Width.Int64 != 8 || file.Height.Int64 != 12 {
+		t.Errorf("ExtractExif = %dx%d; want `%dx%d` - dimensions turned by the orientation", file.Width.Int64, file.Height.Int64, 8, 12)
+	}
+	if file.Latitude.Valid || file.FNumber.Valid || file.ExposureTime.Valid {
+		t.Errorf("ExtractExif - missing tags should be null")
+	}
+}
+
+func TestExtractExifExtendedTags(t *testing.T) {
+	data := exifJPEG(t, []ifdEntry{
+		// Software, ASCII "Gim"
+		{0x0131, 2, 4, [4]byte{'G', 'i', 'm', 0}},
+		// Flash, SHORT fired in auto mode
+		{0x9209, 3, 1, [4]byte{0x19, 0, 0, 0}},
+		// WhiteBalance, SHORT manual
+		{0xa403, 3, 1, [4]byte{1, 0, 0, 0}},
+	})
+
+	file, err := ExtractExif(data)
+	if err != nil {
+		t.Fatalf("ExtractExif - error: %s", err)
+	}
+
+	if file.Software.String != "Gim" {
+		t.Errorf("ExtractExif - software %q, expected %q", file.Software.String, "Gim")
+	}
+	if !file.Flash.Valid || !file.Flash.Bool {
+		t.Errorf("ExtractExif - flash %v, expected fired", file.Flash)
+	}
+	if file.WhiteBalance.String != "manual" {
+		t.Errorf("ExtractExif - white balance %q, expected %q", file.WhiteBalance.String, "manual")
+	}
+	if file.LensModel.Valid || file.MeteringMode.Valid {
+		t.Errorf("ExtractExif - missing tags should be null")
+	}
+	if !strings.Contains(file.RawExif.String, `"Software"`) {
+		t.Errorf("ExtractExif - raw EXIF %s, expected Software", file.RawExif.String)
+	}
+}
+
+func TestExtractExifInvalidOrientation(t *testing.T) {
+	data := exifJPEG(t, []ifdEntry{
+		// Orientation, SHORT 0
+		{0x0112, 3, 1, [4]byte{0, 0, 0, 0}},
+	})
+
+	if file, _ := ExtractExif(data); file.Orientation.Valid {
+		t.Errorf("ExtractExif - orientation %d, expected null", file.Orientation.Int64)
+	}
+}
+
+func TestExtractExifIFDCycle(t *testing.T) {
+	tiff := new(bytes.Buffer)
+	tiff.WriteString("II*\x00")
+	// IFD0 at 8 links to an empty IFD at 14 which links back to IFD0
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+	binary.Write(tiff, binary.LittleEndian, uint16(0))
+	binary.Write(tiff, binary.LittleEndian, uint32(14))
+	binary.Write(tiff, binary.LittleEndian, uint16(0))
+	binary.Write(tiff, binary.LittleEndian, uint32(8))
+
+	done := make(chan error)
+	go func() {
+		_, err := ExtractExif(tiff.Bytes())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("ExtractExif - cyclic IFDs, expected an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ExtractExif - cyclic IFDs are followed forever")
+	}
+}
+
+func TestExtractExifSizeOverflow(t *testing.T) {
+	// 0x40000001 LONG values take 4 bytes once the size overflows
+	data := exifJPEG(t, []ifdEntry{{0x8769, 4, 0x40000001, [4]byte{0x1a, 0, 0, 0}}})
+
+	if _, err := ExtractExif(data); err == nil {
+		t.Errorf("ExtractExif - size of a tag overflows, expected an error")
+	}
+}
+
+func FuzzExtractExif(f *testing.F) {
+	valid := exifJPEG(f, []ifdEntry{
+		{0x010f, 2, 4, [4]byte{'L', 'e', 'i', 0}},
+		{0x0112, 3, 1, [4]byte{6, 0, 0, 0}},
+	})
+
+	f.Add([]byte{})
+	f.Add([]byte("not an image"))
+	f.Add(encodedImage(f, "png"))
+	f.Add(encodedImage(f, "jpeg"))
+	f.Add(valid)
+	f.Add(valid[:40])
+	// Orientation declaring more values than the IFD holds
+	f.Add(exifJPEG(f, []ifdEntry{{0x0112, 3, 1000, [4]byte{0xff, 0xff, 0xff, 0xff}}}))
+	// Count of values whose size overflows 32 bits
+	f.Add(exifJPEG(f, []ifdEntry{{0x8769, 4, 0x40000001, [4]byte{0x1a, 0, 0, 0}}}))
+	// Exif IFD pointer out of bounds
+	f.Add(exifJPEG(f, []ifdEntry{{0x8769, 4, 1, [4]byte{0xff, 0xff, 0, 0}}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, _ := ExtractExif(data)
+		if file.Size.Int64 != int64(len(data)) {
+			t.Errorf("ExtractExif - size %d, expected %d", file.Size.Int64, len(data))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package image
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/h2non/filetype"
+)
+
+// acceptedTypes maps accepted MIME types to extensions of stored originals
+var acceptedTypes = map[string]string{
+	"image/jpeg":        "jpg",
+	"image/png":         "png",
+	"image/gif":         "gif",
+	"image/webp":        "webp",
+	"image/tiff":        "tif",
+	"image/heif":        "heif",
+	"image/heic":        "heic",
+	"image/x-canon-cr2": "cr2",
+	"image/x-nikon-nef": "nef",
+	"image/x-sony-arw":  "arw",
+	"image/x-adobe-dng": "dng",
+}
+
+// tiffBasedTypes are formats detected as TIFF by their content. Only the extension tells them apart
+var tiffBasedTypes = map[string]string{
+	"nef": "image/x-nikon-nef",
+	"arw": "image/x-sony-arw",
+	"dng": "image/x-adobe-dng",
+	"cr2": "image/x-canon-cr2",
+}
+
+// SniffType detects a type of the file from its content, the name given by the client
+// is used only to tell apart formats sharing the same signature. It returns the MIME type,
+// the extension and whether the type is accepted
+func SniffType(data []byte, name string) (string, string, bool) {
+	kind, err := filetype.Match(data)
+	if err != nil || kind == filetype.Unknown {
+		return "", "", false
+	}
+
+	mimeType := kind.MIME.Value
+	extension := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+
+	switch {
+	case mimeType == "image/tiff" && tiffBasedTypes[extension] != "":
+		mimeType = tiffBasedTypes[extension]
+	case mimeType == "image/heif" && extension == "heic":
+		mimeType = "image/heic"
+	}
+
+	storedExtension, ok := acceptedTypes[mimeType]
+
+	return mimeType, storedExtension, ok
+}
@@ -0,0 +1,71 @@
+package image
+
+import "testing"
+
+// header pads the signature, detection reads more than the magic bytes
+func header(signature string) []byte {
+	return append([]byte(signature), make([]byte, 32)...)
+}
+
+func TestSniffType(t *testing.T) {
+	jpeg := header("\xff\xd8\xff\xe0")
+	png := header("\x89PNG\r\n\x1a\n")
+	gif := header("GIF89a")
+	webp := header("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	tiff := header("II*\x00\x08\x00\x00\x00")
+	bigEndianTiff := header("MM\x00*\x00\x00\x00\x08")
+	cr2 := header("II*\x00\x10\x00\x00\x00CR\x02\x00")
+	heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	mif1 := []byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1heic")
+
+	cases := []struct {
+		data      []byte
+		name      string
+		mimeType  string
+		extension string
+	}{
+		{jpeg, "photo.jpg", "image/jpeg", "jpg"},
+		{png, "photo.png", "image/png", "png"},
+		{gif, "animation.gif", "image/gif", "gif"},
+		{webp, "photo.webp", "image/webp", "webp"},
+		{tiff, "scan.tif", "image/tiff", "tif"},
+		{bigEndianTiff, "scan.tiff", "image/tiff", "tif"},
+		{heic, "photo.heic", "image/heic", "heic"},
+		{heic, "photo.heif", "image/heif", "heif"},
+		{mif1, "photo.HEIC", "image/heic", "heic"},
+		{tiff, "photo.nef", "image/x-nikon-nef", "nef"},
+		{tiff, "photo.ARW", "image/x-sony-arw", "arw"},
+		{bigEndianTiff, "photo.dng", "image/x-adobe-dng", "dng"},
+		{tiff, "photo.cr2", "image/x-canon-cr2", "cr2"},
+		{cr2, "photo.cr2", "image/x-canon-cr2", "cr2"},
+		// The content decides, the extension only tells apart formats with the same signature
+		{png, "photo.jpg", "image/png", "png"},
+		{tiff, "photo.jpg", "image/tiff", "tif"},
+		{cr2, "photo.tif", "image/x-canon-cr2", "cr2"},
+		{heic, "photo.nef", "image/heif", "heif"},
+		{jpeg, "photo.nef", "image/jpeg", "jpg"},
+	}
+
+	for _, c := range cases {
+		mimeType, extension, ok := SniffType(c.data, c.name)
+		if !ok || mimeType != c.mimeType || extension != c.extension {
+			t.Errorf(
+				"SniffType(%q) = %s, %s, %t; want `%s, %s`",
+				c.name,
+				mimeType,
+				extension,
+				ok,
+				c.mimeType,
+				c.extension,
+			)
+		}
+	}
+}
+
+func TestSniffTypeRejected(t *testing.T) {
+	for _, data := range [][]byte{header("text"), header("BM"), header("%PDF-1.4"), {}} {
+		if mimeType, _, ok := SniffType(data, "photo.jpg"); ok {
+			t.Errorf("SniffType(%q) = %s; want rejected", data, mimeType)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	model "photos/model"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+const (
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+)
+
+// IPTC datasets of the application record
+const (
+	iptcObjectName = 5
+	iptcKeywords   = 25
+	iptcCaption    = 120
+)
+
+// maxRating is the highest star rating, -1 marks rejected photos and is ignored
+const maxRating = 5
+
+// xmpPacket finds the XMP packet. Every format embeds it as plain XML, so it's found
+// by its root element wherever it is
+func xmpPacket(data []byte) []byte {
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start < 0 {
+		return nil
+	}
+
+	end := bytes.Index(data[start:], []byte("</x:xmpmeta>"))
+	if end < 0 {
+		return nil
+	}
+
+	return data[start : start+end+len("</x:xmpmeta>")]
+}
+
+// setRating keeps a star rating in the 0-5 range
+func setRating(file *model.File, value string) {
+	rating, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err == nil && rating >= 0 && rating <= maxRating {
+		file.Rating = null.IntFrom(int64(rating))
+	}
+}
+
+// readXMP fills title, caption, keywords and rating from the XMP packet. Title and caption
+// are language alternatives, the first one is taken
+func readXMP(data []byte, file *model.File) {
+	packet := xmpPacket(data)
+	if packet == nil {
+		return
+	}
+
+	var title, caption []string
+	keywords := []string{}
+	var property xml.Name
+	inItem := false
+
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Space == rdfNamespace && t.Name.Local == "Description":
+				for _, attr := range t.Attr {
+					if attr.Name.Space == xmpNamespace && attr.Name.Local == "Rating" {
+						setRating(file, attr.Value)
+					}
+				}
+			case t.Name.Space == rdfNamespace && t.Name.Local == "li":
+				inItem = true
+			case t.Name.Space == dcNamespace || t.Name.Space == xmpNamespace:
+				property = t.Name
+			}
+		case xml.EndElement:
+			switch {
+			case t.Name.Space == rdfNamespace && t.Name.Local == "li":
+				inItem = false
+			case t.Name == property:
+				property = xml.Name{}
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(t))
+			if value == "" {
+				continue
+			}
+
+			switch {
+			case property == xml.Name{Space: xmpNamespace, Local: "Rating"}:
+				setRating(file, value)
+			case !inItem:
+			case property == xml.Name{Space: dcNamespace, Local: "title"}:
+				title = append(title, value)
+			case property == xml.Name{Space: dcNamespace, Local: "description"}:
+				caption = append(caption, value)
+			case property == xml.Name{Space: dcNamespace, Local: "subject"}:
+				keywords = append(keywords, value)
+			}
+		}
+	}
+
+	if len(title) > 0 {
+		file.Title = null.StringFrom(title[0])
+	}
+	if len(caption) > 0 {
+		file.Caption = null.StringFrom(caption[0])
+	}
+	if len(keywords) > 0 {
+		file.Keywords = keywords
+	}
+}
+
+// jpegSegment returns data of the first JPEG segment with the marker which starts
+// with the prefix. The search stops at the image data
+func jpegSegment(data []byte, marker byte, prefix []byte) []byte {
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		if data[i+1] == 0xda {
+			return nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+
+		segment := data[i+4 : i+2+length]
+		if data[i+1] == marker && bytes.HasPrefix(segment, prefix) {
+			return segment[len(prefix):]
+		}
+
+		i += 2 + length
+	}
+
+	return nil
+}
+
+// iptcRecord finds the IPTC-NAA resource among Photoshop image resources
+func iptcRecord(resources []byte) []byte {
+	for i := 0; i+12 <= len(resources); {
+		if !bytes.Equal(resources[i:i+4], []byte("8BIM")) {
+			return nil
+		}
+
+		id := binary.BigEndian.Uint16(resources[i+4:])
+		// Pascal string name padded to an even length
+		nameLength := int(resources[i+6]) + 1
+		nameLength += nameLength % 2
+		position := i + 6 + nameLength
+		if position+4 > len(resources) {
+			return nil
+		}
+
+		size := int(binary.BigEndian.Uint32(resources[position:]))
+		position += 4
+		if size < 0 || position+size > len(resources) {
+			return nil
+		}
+
+		if id == 0x0404 {
+			return resources[position : position+size]
+		}
+
+		i = position + size + size%2
+	}
+
+	return nil
+}
+
+// readIPTC fills title, caption and keywords from IPTC in a JPEG where XMP didn't set them
+func readIPTC(data []byte, file *model.File) {
+	record := iptcRecord(jpegSegment(data, 0xed, []byte("Photoshop 3.0\x00")))
+
+	keywords := []string{}
+	for i := 0; i+5 <= len(record); {
+		if record[i] != 0x1c {
+			break
+		}
+
+		recordNumber, dataset := record[i+1], record[i+2]
+		size := int(binary.BigEndian.Uint16(record[i+3:]))
+		// Extended datasets longer than 32767 bytes aren't used for text
+		if size&0x8000 != 0 || i+5+size > len(record) {
+			break
+		}
+
+		// Values are often NUL padded, Postgres doesn't store NULs in text
+		value := strings.ReplaceAll(string(record[i+5:i+5+size]), "\x00", "")
+		value = strings.TrimSpace(strings.ToValidUTF8(value, ""))
+		i += 5 + size
+		if recordNumber != 2 || value == "" {
+			continue
+		}
+
+		switch dataset {
+		case iptcObjectName:
+			if !file.Title.Valid {
+				file.Title = null.StringFrom(value)
+			}
+		case iptcCaption:
+			if !file.Caption.Valid {
+				file.Caption = null.StringFrom(value)
+			}
+		case iptcKeywords:
+			keywords = append(keywords, value)
+		}
+	}
+
+	if len(file.Keywords) == 0 && len(keywords) > 0 {
+		file.Keywords = keywords
+	}
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	model "photos/model"
+)
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmp:Rating="4">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Harbour</rdf:li></rdf:Alt></dc:title>
+   <dc:description><rdf:Alt><rdf:li xml:lang="x-default">Boats at dawn</rdf:li></rdf:Alt></dc:description>
+   <dc:subject><rdf:Bag><rdf:li>sea</rdf:li><rdf:li>boat</rdf:li></rdf:Bag></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// iptcJPEG returns a JPEG with an APP13 segment holding the IPTC datasets of record 2
+func iptcJPEG(t testing.TB, datasets map[byte][]string) []byte {
+	record := new(bytes.Buffer)
+	for _, dataset := range []byte{iptcObjectName, iptcKeywords, iptcCaption} {
+		for _, value := range datasets[dataset] {
+			record.Write([]byte{0x1c, 2, dataset})
+			binary.Write(record, binary.BigEndian, uint16(len(value)))
+			record.WriteString(value)
+		}
+	}
+
+	resources := new(bytes.Buffer)
+	resources.WriteString("8BIM")
+	binary.Write(resources, binary.BigEndian, uint16(0x0404))
+	resources.Write([]byte{0, 0})
+	binary.Write(resources, binary.BigEndian, uint32(record.Len()))
+	resources.Write(record.Bytes())
+
+	segment := append([]byte("Photoshop 3.0\x00"), resources.Bytes()...)
+	app13 := []byte{0xff, 0xed, 0, 0}
+	binary.BigEndian.PutUint16(app13[2:], uint16(len(segment)+2))
+
+	image := encodedImage(t, "jpeg")
+	result := append([]byte{}, image[:2]...)
+	result = append(result, app13...)
+	result = append(result, segment...)
+
+	return append(result, image[2:]...)
+}
+
+func TestReadXMP(t *testing.T) {
+	file := model.File{}
+	readXMP(append([]byte("binary\x00data"), testXMP...), &file)
+
+	if file.Title.String != "Harbour" || file.Caption.String != "Boats at dawn" {
+		t.Errorf("readXMP - title %q and caption %q, expected %q and %q", file.Title.String, file.Caption.String, "Harbour", "Boats at dawn")
+	}
+	if !reflect.DeepEqual(file.Keywords, []string{"sea", "boat"}) {
+		t.Errorf("readXMP - keywords %v, expected %v", file.Keywords, []string{"sea", "boat"})
+	}
+	if file.Rating.Int64 != 4 {
+		t.Errorf("readXMP - rating %d, expected %d", file.Rating.Int64, 4)
+	}
+}
+
+func TestReadXMPInvalidRating(t *testing.T) {
+	file := model.File{}
+	readXMP([]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`+
+		`<rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:Rating="-1"/></rdf:RDF></x:xmpmeta>`), &file)
+
+	if file.Rating.Valid {
+		t.Errorf("readXMP - rating %d, expected null", file.Rating.Int64)
+	}
+}
+
+func TestReadIPTC(t *testing.T) {
+	file := model.File{}
+	readIPTC(iptcJPEG(t, map[byte][]string{
+		iptcObjectName: {"Harbour"},
+		iptcCaption:    {"Boats at dawn\x00\x00"},
+		iptcKeywords:   {"sea", "boat", "\x00"},
+	}), &file)
+
+	if file.Title.String != "Harbour" || file.Caption.String != "Boats at dawn" {
+		t.Errorf("readIPTC - title %q and caption %q, expected %q and %q", file.Title.String, file.Caption.String, "Harbour", "Boats at dawn")
+	}
+	if !reflect.DeepEqual(file.Keywords, []string{"sea", "boat"}) {
+		t.Errorf("readIPTC - keywords %v, expected %v", file.Keywords, []string{"sea", "boat"})
+	}
+}
+
+func TestExtractExifPrefersXMP(t *testing.T) {
+	data := iptcJPEG(t, map[byte][]string{iptcObjectName: {"Old title"}, iptcCaption: {"Old caption"}})
+	data = append(data, []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`+
+		`<rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title><rdf:Alt><rdf:li>New title</rdf:li></rdf:Alt></dc:title>`+
+		`</rdf:Description></rdf:RDF></x:xmpmeta>`)...)
+
+	file, _ := ExtractExif(data)
+	if file.Title.String != "New title" || file.Caption.String != "Old caption" {
+		t.Errorf("ExtractExif - title %q and caption %q, expected %q and %q", file.Title.String, file.Caption.String, "New title", "Old caption")
+	}
+}
@@ -1,14 +1,104 @@
 package image
 
 import (
+	"strconv"
+
 	model "photos/model"
 
 	"gopkg.in/gographics/imagick.v3/imagick"
 )
 
-const mobileWidth int64 = 640
-const tabletWidth int64 = 1280
-const displayWidth int64 = 1920
+// MobileSuffix is added to the hash of a file to name its resized version. Files uploaded
+// before renditions were introduced have only this one
+const MobileSuffix = "_mobile"
+
+// ThumbnailName is the name of the square thumbnail rendition
+const ThumbnailName = "thumb"
+
+const thumbnailSize int64 = 256
+
+var defaultWidths = []int64{640, 1280, 1920}
+
+// Rendition is a resized version of an image generated for every upload
+type Rendition struct {
+	Name   string
+	Width  int64
+	Square bool
+}
+
+// Format is an encoding in which every rendition is stored
+type Format struct {
+	Name      string
+	Extension string
+	MimeType  string
+	Quality   uint
+}
+
+// RenderedImage is a rendition encoded in a format
+type RenderedImage struct {
+	Rendition Rendition
+	Format    Format
+	Width     int64
+	Height    int64
+	Data      []byte
+}
+
+var jpegFormat = Format{"JPEG", "jpg", "image/jpeg", 80}
+var webpFormat = Format{"WEBP", "webp", "image/webp", 75}
+var avifFormat = Format{"AVIF", "avif", "image/avif", 60}
+
+var renditions = renditionsFromWidths(defaultWidths)
+var formats = []Format{jpegFormat, webpFormat}
+
+func renditionsFromWidths(widths []int64) []Rendition {
+	result := []Rendition{{ThumbnailName, thumbnailSize, true}}
+	for _, width := range widths {
+		result = append(result, Rendition{RenditionName(width), width, false})
+	}
+
+	return result
+}
+
+// RenditionName returns the name of a rendition resized to the width
+func RenditionName(width int64) string {
+	return strconv.FormatInt(width, 10)
+}
+
+// ConfigureRenditions sets widths of renditions generated besides the thumbnail and
+// whether AVIF is produced besides JPEG and WebP. Empty widths keep the default set
+func ConfigureRenditions(widths []int64, avif bool) {
+	if len(widths) == 0 {
+		widths = defaultWidths
+	}
+	renditions = renditionsFromWidths(widths)
+
+	formats = []Format{jpegFormat, webpFormat}
+	if avif {
+		formats = append(formats, avifFormat)
+	}
+}
+
+// Renditions returns the configured rendition set
+func Renditions() []Rendition {
+	return renditions
+}
+
+// LargestRendition returns the widest configured rendition. Older clients ask for it as `mobile`
+func LargestRendition() Rendition {
+	largest := renditions[0]
+	for _, rendition := range renditions {
+		if rendition.Width > largest.Width {
+			largest = rendition
+		}
+	}
+
+	return largest
+}
+
+// Formats returns formats in which renditions are stored, the most compatible first
+func Formats() []Format {
+	return formats
+}
 
 func getDimensions(width, height, resizeTo int64) (int64, int64) {
 	if width <= resizeTo {
@@ -21,22 +111,129 @@ func getDimensions(width, height, resizeTo int64) (int64, int64) {
 	return resizeTo, int64(h)
 }
 
-// ResizeImage resize an image
-func ResizeImage(image []byte, info model.File, uploadDir string) {
+// resize scales the image down to the rendition. Square renditions are cropped
+// from the center after the shorter side is scaled to the size
+func resize(mw *imagick.MagickWand, rendition Rendition) error {
+	width, height := int64(mw.GetImageWidth()), int64(mw.GetImageHeight())
+	if !rendition.Square {
+		w, h := getDimensions(width, height, rendition.Width)
+
+		return mw.ResizeImage(uint(w), uint(h), imagick.FILTER_LANCZOS)
+	}
+
+	size := rendition.Width
+	if width < size {
+		size = width
+	}
+	if height < size {
+		size = height
+	}
+
+	w, h := width*size/height, size
+	if width < height {
+		w, h = size, height*size/width
+	}
+	if err := mw.ResizeImage(uint(w), uint(h), imagick.FILTER_LANCZOS); err != nil {
+		return err
+	}
+
+	if err := mw.CropImage(uint(size), uint(size), int((w-size)/2), int((h-size)/2)); err != nil {
+		return err
+	}
+
+	return mw.SetImagePage(uint(size), uint(size), 0, 0)
+}
+
+// firstFrame reads the image. Animated GIFs and multi-page TIFFs are represented
+// by their first frame. The caller destroys the returned wand
+func firstFrame(image []byte) (*imagick.MagickWand, error) {
+	source := imagick.NewMagickWand()
+	defer source.Destroy()
+	if err := source.ReadImageBlob(image); err != nil {
+		return nil, err
+	}
+
+	source.SetIteratorIndex(0)
+
+	return source.GetImage(), nil
+}
+
+// rotate turns the image clockwise by the degrees
+func rotate(mw *imagick.MagickWand, degrees int64) error {
+	if degrees%360 == 0 {
+		return nil
+	}
+
+	background := imagick.NewPixelWand()
+	defer background.Destroy()
+	background.SetColor("none")
+
+	return mw.RotateImage(background, float64(degrees))
+}
+
+// SwapsSides tells whether the EXIF orientation together with the user rotation turns
+// the image on its side, so its displayed width is the stored height
+func SwapsSides(orientation, rotation int64) bool {
+	return (orientation >= 5 && orientation <= 8) != (rotation%180 != 0)
+}
+
+// Initialize sets up ImageMagick. It has to be called once before any image is resized
+func Initialize() {
 	imagick.Initialize()
-	defer imagick.Terminate()
+}
+
+// Terminate releases ImageMagick, no image can be resized after that
+func Terminate() {
+	imagick.Terminate()
+}
+
+// ResizeImage generates every configured rendition of an image in every configured format.
+// The image is turned upright as its EXIF orientation says, rotated clockwise by the user
+// rotation in degrees and changed by the edits. HEIC and RAW files need ImageMagick built
+// with libheif and libraw delegates
+func ResizeImage(image []byte, rotation int64, edits []model.Edit) ([]RenderedImage, error) {
+	mw, err := editedFrame(image, rotation, edits)
+	if err != nil {
+		return nil, err
+	}
+	defer mw.Destroy()
 
-	mw := imagick.NewMagickWand()
-	if err := mw.ReadImageBlob(image); err != nil {
-		panic(err)
+	// Orientation was applied, stripping it keeps viewers from rotating renditions again
+	if err := mw.StripImage(); err != nil {
+		return nil, err
 	}
 
-	mobileW, mobileH := getDimensions(info.Width.Int64, info.Height.Int64, displayWidth)
-	mw.ResizeImage(uint(mobileW), uint(mobileH), imagick.FILTER_LANCZOS)
+	rendered := []RenderedImage{}
+	for _, rendition := range renditions {
+		resized := mw.Clone()
+		err := resize(resized, rendition)
+
+		for _, format := range formats {
+			if err != nil {
+				break
+			}
+
+			if err = resized.SetImageFormat(format.Name); err != nil {
+				break
+			}
+			if err = resized.SetImageCompressionQuality(format.Quality); err != nil {
+				break
+			}
+
+			rendered = append(rendered, RenderedImage{
+				Rendition: rendition,
+				Format:    format,
+				Width:     int64(resized.GetImageWidth()),
+				Height:    int64(resized.GetImageHeight()),
+				Data:      resized.GetImageBlob(),
+			})
+		}
 
-	if err := mw.SetImageCompressionQuality(75); err != nil {
-		panic(err)
+		resized.Destroy()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	mw.WriteImage(uploadDir + info.Hash.String + "_mobile")
+	return rendered, nil
 }
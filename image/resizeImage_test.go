@@ -0,0 +1,25 @@
+package image
+
+import "testing"
+
+func TestSwapsSides(t *testing.T) {
+	cases := []struct {
+		orientation, rotation int64
+		want                  bool
+	}{
+		{0, 0, false},
+		{1, 180, false},
+		{6, 0, true},
+		{8, 0, true},
+		{1, 90, true},
+		{0, 270, true},
+		{6, 90, false},
+		{5, 180, true},
+	}
+
+	for _, c := range cases {
+		if got := SwapsSides(c.orientation, c.rotation); got != c.want {
+			t.Errorf("SwapsSides(%d, %d) = %t; want `%t`", c.orientation, c.rotation, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func fetchFileJobRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	fileID, err := strconv.Atoi(p.ByName("file"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	status, job := appDB.GetFileJob(fileID, userID, db)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+
+	response, _ := json.Marshal(job)
+	jsonResponse(w, status, string(response))
+}
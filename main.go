@@ -2,10 +2,15 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 
+	constants "photos/constants"
+	"photos/image"
+	"photos/storage"
+
 	"github.com/julienschmidt/httprouter"
 	_ "github.com/lib/pq"
 	"github.com/rs/zerolog"
@@ -16,11 +21,8 @@ import (
 // FileField is name of the field with a file
 const FileField = "file"
 
-// UploadDir point to the place where files are stored
-const UploadDir = "./files/"
-
-const userID = 1 // TODO: use real userID
 var db *sql.DB
+var store storage.Storage
 
 func jsonResponse(w http.ResponseWriter, code int, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -28,9 +30,16 @@ func jsonResponse(w http.ResponseWriter, code int, message string) {
 	_, _ = fmt.Fprint(w, message)
 }
 
+// errorMessage wraps an error into JSON body understandable by the client
+func errorMessage(err error) string {
+	message, _ := json.Marshal(map[string]string{"error": err.Error()})
+
+	return string(message)
+}
+
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
 }
 
 func main() {
@@ -40,35 +49,106 @@ func main() {
 	}
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	db = dbConnection()
+	store = storageConnection()
+	renditionConfig()
+	uploadConfig()
+	geocoderConfig()
+	searchConfig()
+
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		reconcileCommand(os.Args[2:])
+		return
+	}
+
+	image.Initialize()
+	defer image.Terminate()
+
+	go purgeTrash(trashRetention())
+	go purgeUploads()
+	go nameMissingPlaces()
+	startWorkers(workersCount())
 
 	router := httprouter.New()
 	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Access-Control-Request-Method") != "" {
 			// Set CORS headers
 			header := w.Header()
-			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
 			header.Set("Access-Control-Allow-Origin", "*")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Link-Password, "+tusHeaders)
+			header.Set("Access-Control-Expose-Headers", tusHeaders)
 		}
+		tusOptions(w.Header())
 
 		// Adjust status code to 204
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	router.POST("/upload", uploadFilesRoute)
-	router.GET("/images", fetchFilesRoute)
-
-	router.GET("/albums", fetchAlbumsRoute)
-	router.POST("/albums", addNewAlbumRoute)
-
-	router.DELETE("/album/:id", deleteAlbumRoute)
-	router.GET("/album/:id", fetchAlbumContentRoute)
-	router.PUT("/album/:id/files", addFilesToAlbumRoute)
-	router.DELETE("/album/:id/file", removeFromAlbumRoute)
-	router.PUT("/album/:id/cover", setAlbumCoverRoute)
-
-	router.DELETE("/files/delete", deleteFileRoute)
-
-	router.ServeFiles("/files/*filepath", http.Dir("./files"))
+	router.POST("/register", registerRoute)
+	router.POST("/login", loginRoute)
+	router.POST("/logout", authenticate(constants.Scope["account"], logoutRoute))
+	router.GET("/me", authenticate("", fetchUserRoute))
+
+	router.GET("/tokens", authenticate(constants.Scope["account"], fetchTokensRoute))
+	router.POST("/tokens", authenticate(constants.Scope["account"], addNewTokenRoute))
+	router.DELETE("/token/:id", authenticate(constants.Scope["account"], revokeTokenRoute))
+
+	router.POST("/upload", authenticate(constants.Scope["upload"], uploadFilesRoute))
+	router.POST("/uploads", authenticate(constants.Scope["upload"], tusHandle(createUploadRoute)))
+	router.HEAD("/uploads/:id", authenticate(constants.Scope["upload"], tusHandle(headUploadRoute)))
+	router.PATCH("/uploads/:id", authenticate(constants.Scope["upload"], tusHandle(patchUploadRoute)))
+	router.DELETE("/uploads/:id", authenticate(constants.Scope["upload"], tusHandle(deleteUploadRoute)))
+	router.GET("/images", authenticate(constants.Scope["readFiles"], fetchFilesRoute))
+	router.GET("/timeline", authenticate(constants.Scope["readFiles"], fetchTimelineRoute))
+	router.GET("/timeline/buckets", authenticate(constants.Scope["readFiles"], fetchTimelineBucketsRoute))
+	router.GET("/search", authenticate(constants.Scope["readFiles"], searchFilesRoute))
+	router.GET("/search/facets", authenticate(constants.Scope["readFiles"], fetchSearchFacetsRoute))
+	router.GET("/jobs/:file", authenticate(constants.Scope["readFiles"], fetchFileJobRoute))
+	router.POST("/collage", authenticate(constants.Scope["upload"], createCollageRoute))
+	router.POST("/animation", authenticate(constants.Scope["upload"], createAnimationRoute))
+	router.GET("/sources/:file", authenticate(constants.Scope["readFiles"], fetchFileSourcesRoute))
+
+	router.GET("/albums", authenticate(constants.Scope["readFiles"], fetchAlbumsRoute))
+	router.POST("/albums", authenticate(constants.Scope["manageAlbums"], addNewAlbumRoute))
+
+	router.DELETE("/album/:id", authenticate(constants.Scope["manageAlbums"], deleteAlbumRoute))
+	router.GET("/album/:id", authenticate(constants.Scope["readFiles"], fetchAlbumContentRoute))
+	router.PUT("/album/:id/files", authenticate(constants.Scope["manageAlbums"], addFilesToAlbumRoute))
+	router.DELETE("/album/:id/file", authenticate(constants.Scope["manageAlbums"], removeFromAlbumRoute))
+	router.PUT("/album/:id/cover", authenticate(constants.Scope["manageAlbums"], setAlbumCoverRoute))
+
+	router.GET("/album/:id/members", authenticate(constants.Scope["readFiles"], fetchAlbumMembersRoute))
+	router.POST("/album/:id/members", authenticate(constants.Scope["manageAlbums"], addAlbumMemberRoute))
+	router.PATCH("/album/:id/members", authenticate(constants.Scope["manageAlbums"], changeAlbumMemberRoute))
+	router.DELETE("/album/:id/members", authenticate(constants.Scope["manageAlbums"], removeAlbumMemberRoute))
+
+	router.GET("/album/:id/links", authenticate(constants.Scope["manageAlbums"], fetchAlbumLinksRoute))
+	router.POST("/album/:id/links", authenticate(constants.Scope["manageAlbums"], addAlbumLinkRoute))
+	router.DELETE("/album/:id/links", authenticate(constants.Scope["manageAlbums"], deleteAlbumLinkRoute))
+
+	router.GET("/link/:token", fetchLinkContentRoute)
+	router.GET("/link/:token/file/:file/:variant", serveLinkFileRoute)
+	router.HEAD("/link/:token/file/:file/:variant", serveLinkFileRoute)
+
+	router.DELETE("/files/delete", authenticate(constants.Scope["delete"], deleteFileRoute))
+	router.GET("/file/:id/:variant", authenticate(constants.Scope["readFiles"], serveFileRoute))
+	router.HEAD("/file/:id/:variant", authenticate(constants.Scope["readFiles"], serveFileRoute))
+	router.POST("/file/:id/rotate", authenticate(constants.Scope["upload"], rotateFileRoute))
+	router.POST("/file/:id/edits", authenticate(constants.Scope["upload"], addEditRoute))
+	router.POST("/file/:id/undo", authenticate(constants.Scope["upload"], undoEditRoute))
+	router.DELETE("/file/:id/edits", authenticate(constants.Scope["upload"], revertFileRoute))
+	router.POST("/file/:id/copy", authenticate(constants.Scope["upload"], copyFileRoute))
+	router.PUT("/file/:id/tags", authenticate(constants.Scope["upload"], setFileTagsRoute))
+
+	router.GET("/trash", authenticate(constants.Scope["readFiles"], fetchTrashRoute))
+	router.POST("/trash/restore", authenticate(constants.Scope["delete"], restoreFilesRoute))
+	router.DELETE("/trash", authenticate(constants.Scope["delete"], emptyTrashRoute))
+
+	router.GET("/sharing/files", authenticate(constants.Scope["readFiles"], fetchSharedFilesRoute))
+	router.GET("/sharing/file/:id", authenticate(constants.Scope["share"], fetchFileMembersRoute))
+	router.POST("/sharing/file/:id", authenticate(constants.Scope["share"], addFileMemberRoute))
+	router.PATCH("/sharing/file/:id", authenticate(constants.Scope["share"], changeFileMemberRoute))
+	router.DELETE("/sharing/file/:id", authenticate(constants.Scope["share"], removeFileMemberRoute))
 
 	log.Info().Msg("Running")
 	http.ListenAndServe(":8080", router)
@@ -1,12 +1,15 @@
 package model
 
 import (
+	"time"
+
 	"gopkg.in/guregu/null.v3"
 )
 
 // File file descriptor
 type File struct {
 	ID           null.Int    `json:"id,omitempty"`
+	Type         null.String `json:"type,omitempty"`
 	Date         null.Time   `json:"date,omitempty"`         // DateTime
 	Width        null.Int    `json:"width,omitempty"`        // PixelXDimension
 	Height       null.Int    `json:"height,omitempty"`       // PixelYDimension
@@ -25,6 +28,86 @@ type File struct {
 	MimeType     null.String `json:"mimeType,omitempty"`
 	Size         null.Int    `json:"size,omitempty"`
 	Owner        null.Int    `json:"owner,omitempty"`
+	TrashedAt    null.Time   `json:"trashedAt,omitempty"`
+	Status       null.String `json:"status,omitempty"`
+	Duration     null.Float  `json:"duration,omitempty"`     // seconds, videos only
+	Codec        null.String `json:"codec,omitempty"`        // videos only
+	LensMake     null.String `json:"lensMake,omitempty"`     // LensMake
+	LensModel    null.String `json:"lensModel,omitempty"`    // LensModel
+	Flash        null.Bool   `json:"flash,omitempty"`        // Flash, whether it fired
+	WhiteBalance null.String `json:"whiteBalance,omitempty"` // WhiteBalance
+	MeteringMode null.String `json:"meteringMode,omitempty"` // MeteringMode
+	ExposureBias null.Float  `json:"exposureBias,omitempty"` // ExposureBiasValue (EV)
+	Software     null.String `json:"software,omitempty"`     // Software
+	Copyright    null.String `json:"copyright,omitempty"`    // Copyright
+	Title        null.String `json:"title,omitempty"`        // XMP dc:title, IPTC Object Name
+	Caption      null.String `json:"caption,omitempty"`      // XMP dc:description, IPTC Caption
+	Keywords     []string    `json:"keywords,omitempty"`     // XMP dc:subject, IPTC Keywords
+	Rating       null.Int    `json:"rating,omitempty"`       // XMP xmp:Rating, 0-5
+	Tags         []string    `json:"tags,omitempty"`         // set by the user
+	Place        null.String `json:"place,omitempty"`        // reverse geocoded from the location
+	RawExif      null.String `json:"-"`                      // every EXIF tag as JSON, only written
+	Rotation     null.Int    `json:"rotation,omitempty"`     // degrees clockwise set by the user
+	Edits        []Edit      `json:"edits,omitempty"`        // applied to the original after rotation
+}
+
+// Edit is an operation of the edit stack of a file. Only fields of its operation are set
+type Edit struct {
+	Operation  string  `json:"operation"`            // crop, rotate, straighten, adjust or filter
+	X          float64 `json:"x,omitempty"`          // crop, left edge as a fraction of the width
+	Y          float64 `json:"y,omitempty"`          // crop, top edge as a fraction of the height
+	Width      float64 `json:"width,omitempty"`      // crop, a fraction of the width
+	Height     float64 `json:"height,omitempty"`     // crop, a fraction of the height
+	Degrees    int64   `json:"degrees,omitempty"`    // rotate, a multiple of 90 clockwise
+	Angle      float64 `json:"angle,omitempty"`      // straighten, -45 to 45 clockwise
+	Brightness float64 `json:"brightness,omitempty"` // adjust, -100 to 100
+	Contrast   float64 `json:"contrast,omitempty"`   // adjust, -100 to 100
+	Saturation float64 `json:"saturation,omitempty"` // adjust, -100 to 100
+	Filter     string  `json:"filter,omitempty"`     // filter, name of a preset
+}
+
+// TimelineBucket is a day or a month of the timeline. Count is the number of files in the
+// whole bucket, a page may hold only some of them
+type TimelineBucket struct {
+	Key   string `json:"key"` // 2006-01-02 or 2006-01
+	Count int    `json:"count"`
+	Files []File `json:"files,omitempty"`
+}
+
+// Timeline is a page of files grouped by when they were taken. NextCursor is empty on the last page
+type Timeline struct {
+	Buckets    []TimelineBucket `json:"buckets"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// SearchResult is a page of found files. Files found by text have highlights in the same
+// order. NextCursor is empty on the last page
+type SearchResult struct {
+	Files      []File            `json:"files"`
+	Highlights []SearchHighlight `json:"highlights,omitempty"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// SearchHighlight tells how a file matches the searched text. Headline is an excerpt of its
+// text with matched words in <mark> tags, the rest of it is HTML escaped
+type SearchHighlight struct {
+	File     int64   `json:"file"`
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+// Facet is a camera or a lens with the number of found files taken by it
+type Facet struct {
+	Camera string `json:"camera,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Lens   string `json:"lens,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// SearchFacets are distinct cameras and lenses of found files, the most used first
+type SearchFacets struct {
+	Cameras []Facet `json:"cameras"`
+	Lenses  []Facet `json:"lenses"`
 }
 
 // Album descriptor
@@ -38,3 +121,85 @@ type Album struct {
 	CreatedAt string   `json:"createdAt"`
 	File      Cover    `json:"file,omitempty"`
 }
+
+// User descriptor. Password hash never leaves the db package
+type User struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+}
+
+// APIToken descriptor. Token is filled only right after creation,
+// later only its hash is known
+type APIToken struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	Token      string    `json:"token,omitempty"`
+	LastUsedAt null.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Member is a user with whom an album or a file is shared
+type Member struct {
+	User      int    `json:"user"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Privilege string `json:"privilege"`
+}
+
+// AlbumLink is a public link to an album. Token is filled only right after creation
+type AlbumLink struct {
+	ID            int       `json:"id"`
+	Album         int       `json:"album"`
+	Token         string    `json:"token,omitempty"`
+	HasPassword   bool      `json:"hasPassword"`
+	AllowDownload bool      `json:"allowDownload"`
+	ExpiresAt     null.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Rendition is a resized version of a file in one format. Key is where it's stored
+type Rendition struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Width    int64  `json:"width"`
+	Height   int64  `json:"height"`
+	Size     int64  `json:"size"`
+	Key      string `json:"-"`
+}
+
+// Job is processing of an uploaded file
+type Job struct {
+	ID        int         `json:"id"`
+	File      int         `json:"file"`
+	Status    string      `json:"status"`
+	Attempts  int         `json:"attempts"`
+	LastError null.String `json:"lastError"`
+	RunAt     time.Time   `json:"runAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+}
+
+// Upload is a resumable upload. File is set once all bytes are received
+type Upload struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	MimeType  string    `json:"mimeType"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	File      null.Int  `json:"file"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// UploadResult describes what happened with one uploaded file. File is set for created
+// files, DuplicateOf when the user already has the content. Unset ids are left out
+type UploadResult struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	File        *int64 `json:"file,omitempty"`
+	DuplicateOf *int64 `json:"duplicateOf,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
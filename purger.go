@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	appDB "photos/db"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultTrashRetention is how many days files stay in the trash when TRASH_RETENTION_DAYS isn't set
+const defaultTrashRetention = 30
+
+// purgeInterval is how often the trash is checked for expired files
+const purgeInterval = time.Hour
+
+// trashRetention reads the retention from TRASH_RETENTION_DAYS
+func trashRetention() time.Duration {
+	days := defaultTrashRetention
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Warn().Str("value", value).Int("default", days).Msg("Invalid TRASH_RETENTION_DAYS, using the default")
+		} else {
+			days = parsed
+		}
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeTrash permanently deletes files which are in the trash longer than the retention.
+// It runs until the program exits
+func purgeTrash(retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := appDB.PurgeExpiredTrash(retention, store, db)
+		if err != nil {
+			log.Error().Err(err).Caller().Msg("Can't purge the trash")
+		} else if purged > 0 {
+			log.Info().Int("purged", purged).Msg("Expired files purged from the trash")
+		}
+
+		<-ticker.C
+	}
+}
+
+// purgeUploads removes resumable uploads which weren't finished in time.
+// It runs until the program exits
+func purgeUploads() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := appDB.PurgeExpiredUploads(uploadDir, db)
+		if err != nil {
+			log.Error().Err(err).Caller().Msg("Can't purge expired uploads")
+		} else if purged > 0 {
+			log.Info().Int("purged", purged).Msg("Expired uploads purged")
+		}
+
+		<-ticker.C
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	appDB "photos/db"
+
+	"github.com/rs/zerolog/log"
+)
+
+// reconcileCommand removes stored blobs which don't belong to any file, e.g. left
+// after a failed delete. Run as `photos reconcile [-dry-run] [-grace 1h]`
+func reconcileCommand(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only list orphaned blobs")
+	grace := flags.Duration("grace", time.Hour, "skip blobs modified recently, their upload may be in progress")
+	flags.Parse(args)
+
+	orphans, err := appDB.FindOrphanBlobs(store, *grace, db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Can't find orphaned blobs")
+	}
+
+	removed := 0
+	for _, orphan := range orphans {
+		if *dryRun {
+			log.Info().Str("key", orphan.Key).Int64("size", orphan.Size).Msg("Orphaned blob")
+			continue
+		}
+
+		if err := store.Delete(orphan.Key); err != nil {
+			log.Error().Err(err).Str("key", orphan.Key).Msg("Can't remove an orphaned blob")
+			continue
+		}
+
+		removed++
+	}
+
+	log.Info().Int("found", len(orphans)).Int("removed", removed).Msg("Reconciliation finished")
+}
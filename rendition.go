@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	appDB "photos/db"
+	"photos/image"
+	model "photos/model"
+	"photos/video"
+
+	"github.com/rs/zerolog/log"
+)
+
+// preferredTypes are formats picked over JPEG when the client accepts them, the best first
+var preferredTypes = []string{"image/avif", "image/webp"}
+
+// renditionConfig sets up renditions from `RENDITION_WIDTHS` (comma separated widths)
+// and `RENDITION_AVIF` envs. Posters and previews of videos are made by binaries
+// from `FFMPEG_PATH` and `FFPROBE_PATH`, found in PATH by default
+func renditionConfig() {
+	widths := []int64{}
+	for _, value := range strings.Split(os.Getenv("RENDITION_WIDTHS"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		width, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || width <= 0 {
+			log.Warn().Str("value", value).Msg("Invalid rendition width, skipping")
+			continue
+		}
+
+		widths = append(widths, width)
+	}
+
+	image.ConfigureRenditions(widths, os.Getenv("RENDITION_AVIF") == "true")
+	video.Configure(os.Getenv("FFMPEG_PATH"), os.Getenv("FFPROBE_PATH"))
+}
+
+// acceptsType checks if the Accept header lists the media type explicitly. Wildcards
+// are ignored on purpose, `*/*` doesn't mean a browser can decode AVIF
+func acceptsType(accept, mimeType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), mimeType) {
+			continue
+		}
+
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// negotiateRendition picks the best format of a rendition which the client accepts.
+// JPEG is the fallback every client can show
+func negotiateRendition(accept string, renditions []model.Rendition) model.Rendition {
+	for _, mimeType := range preferredTypes {
+		if !acceptsType(accept, mimeType) {
+			continue
+		}
+
+		for _, rendition := range renditions {
+			if rendition.MimeType == mimeType {
+				return rendition
+			}
+		}
+	}
+
+	for _, rendition := range renditions {
+		if rendition.MimeType == "image/jpeg" {
+			return rendition
+		}
+	}
+
+	return renditions[0]
+}
+
+// resolveVariant finds a stored key and a content type of the file's variant. `original`
+// is the uploaded file, `mobile` is an alias of the largest rendition kept for older clients.
+// Videos have a `preview` transcode besides renditions of their poster frame.
+// Files uploaded before renditions existed have only the `_mobile` version
+func resolveVariant(r *http.Request, file model.File, variant string) (string, string, bool) {
+	if variant == "original" {
+		return file.Hash.String, file.MimeType.String, true
+	}
+
+	name := variant
+	if variant == "mobile" {
+		name = image.LargestRendition().Name
+	}
+
+	renditions, err := appDB.GetRenditions(int(file.ID.Int64), name, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int64("file", file.ID.Int64).Str("variant", variant).Msg("Can't fetch renditions")
+
+		return "", "", false
+	}
+
+	if len(renditions) == 0 {
+		if variant == "mobile" {
+			return file.Hash.String + image.MobileSuffix, file.MimeType.String, true
+		}
+
+		return "", "", false
+	}
+
+	rendition := negotiateRendition(r.Header.Get("Accept"), renditions)
+
+	return rendition.Key, rendition.MimeType, true
+}
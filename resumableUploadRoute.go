@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	appDB "photos/db"
+	model "photos/model"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+// tusVersion is the only version of the tus protocol (https://tus.io) the server speaks
+const tusVersion = "1.0.0"
+
+// tusExtensions are implemented extensions of the protocol
+const tusExtensions = "creation,termination,expiration"
+
+// tusHeaders are headers which browsers need to send and read for resumable uploads
+const tusHeaders = "Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Length, " +
+	"Upload-Offset, Upload-Metadata, Upload-Expires, Location, X-File-Id"
+
+// defaultUploadMaxSize is the maximum size of a file when UPLOAD_MAX_SIZE isn't set
+const defaultUploadMaxSize = 1 << 30
+
+// defaultUploadExpiration is how long an upload can be resumed when UPLOAD_EXPIRATION isn't set
+const defaultUploadExpiration = 24 * time.Hour
+
+var uploadDir string
+var uploadMaxSize int64 = defaultUploadMaxSize
+var uploadExpiration = defaultUploadExpiration
+
+// uploadConfig reads resumable uploads settings: `UPLOAD_DIR` where received bytes are kept,
+// `UPLOAD_MAX_SIZE` in bytes and `UPLOAD_EXPIRATION` as a duration, e.g. `24h`
+func uploadConfig() {
+	uploadDir = os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = filepath.Join(os.TempDir(), "photos-uploads")
+	}
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		panic(err)
+	}
+
+	if value := os.Getenv("UPLOAD_MAX_SIZE"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			log.Warn().Str("value", value).Msg("Invalid UPLOAD_MAX_SIZE, using the default")
+		} else {
+			uploadMaxSize = size
+		}
+	}
+
+	if value := os.Getenv("UPLOAD_EXPIRATION"); value != "" {
+		expiration, err := time.ParseDuration(value)
+		if err != nil || expiration <= 0 {
+			log.Warn().Str("value", value).Msg("Invalid UPLOAD_EXPIRATION, using the default")
+		} else {
+			uploadExpiration = expiration
+		}
+	}
+}
+
+// tusOptions adds headers describing the server to a preflight response
+func tusOptions(header http.Header) {
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	header.Set("Tus-Max-Size", strconv.FormatInt(uploadMaxSize, 10))
+}
+
+// tusHandle checks the protocol version and sets headers every tus response has
+func tusHandle(handle authHandle) authHandle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+		enableCors(&w)
+		header := w.Header()
+		header.Set("Tus-Resumable", tusVersion)
+		header.Set("Access-Control-Expose-Headers", tusHeaders)
+
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			header.Set("Tus-Version", tusVersion)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		handle(w, r, p, userID)
+	}
+}
+
+// parseUploadMetadata decodes `Upload-Metadata` header: comma separated pairs of
+// a key and a base64 encoded value
+func parseUploadMetadata(value string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+
+		metadata[parts[0]] = ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err == nil {
+				metadata[parts[0]] = string(decoded)
+			}
+		}
+	}
+
+	return metadata
+}
+
+// uploadHeaders describes the state of the upload
+func uploadHeaders(w http.ResponseWriter, upload model.Upload) {
+	header := w.Header()
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	header.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", "no-store")
+	if upload.File.Valid {
+		header.Set("X-File-Id", strconv.FormatInt(upload.File.Int64, 10))
+	}
+}
+
+func createUploadRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	metadata := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	status, upload, err := appDB.CreateUpload(
+		userID,
+		metadata["filename"],
+		metadata["filetype"],
+		length,
+		uploadMaxSize,
+		uploadExpiration,
+		uploadDir,
+		db,
+	)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	uploadHeaders(w, upload)
+	w.Header().Set("Location", fmt.Sprintf("/uploads/%s", upload.ID))
+	w.WriteHeader(status)
+}
+
+func headUploadRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	status, upload := appDB.GetUpload(p.ByName("id"), userID, db)
+	if status == http.StatusOK {
+		uploadHeaders(w, upload)
+	}
+
+	w.WriteHeader(status)
+}
+
+func patchUploadRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, upload, err := appDB.WriteUpload(p.ByName("id"), userID, offset, r.Body, uploadDir, store, db)
+	if upload.ID != "" {
+		uploadHeaders(w, upload)
+	}
+
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	w.WriteHeader(status)
+}
+
+func deleteUploadRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	w.WriteHeader(appDB.DeleteUpload(p.ByName("id"), userID, uploadDir, db))
+}
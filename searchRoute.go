@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/guregu/null.v3"
+)
+
+// searchConfig sets the language of text search from `SEARCH_LANGUAGE`, a Postgres text search
+// configuration such as `english`. Words are matched as written without it
+func searchConfig() {
+	language := os.Getenv("SEARCH_LANGUAGE")
+	if err := appDB.ConfigureSearch(language, db); err != nil {
+		log.Error().Err(err).Caller().Str("language", language).Msg("Can't set the search language")
+	}
+}
+
+// searchParser reads typed values from the query and remembers if any of them was malformed
+type searchParser struct {
+	query url.Values
+	ok    bool
+}
+
+func (p *searchParser) int(name string) null.Int {
+	value := p.query.Get(name)
+	if value == "" {
+		return null.Int{}
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	p.ok = p.ok && err == nil
+
+	return null.NewInt(number, err == nil)
+}
+
+func (p *searchParser) float(name string) null.Float {
+	value := p.query.Get(name)
+	if value == "" {
+		return null.Float{}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	p.ok = p.ok && err == nil
+
+	return null.NewFloat(number, err == nil)
+}
+
+func (p *searchParser) bool(name string) null.Bool {
+	value := p.query.Get(name)
+	if value == "" {
+		return null.Bool{}
+	}
+
+	flag, err := strconv.ParseBool(value)
+	p.ok = p.ok && err == nil
+
+	return null.NewBool(flag, err == nil)
+}
+
+// time reads a RFC 3339 time or a date. A date ending a range includes the whole day
+func (p *searchParser) time(name string, end bool) null.Time {
+	value := p.query.Get(name)
+	if value == "" {
+		return null.Time{}
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return null.TimeFrom(t)
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	p.ok = p.ok && err == nil
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return null.NewTime(t, err == nil)
+}
+
+// searchFilters reads filters of the search from the query. It's false when a value is malformed
+func searchFilters(r *http.Request) (appDB.SearchFilters, bool) {
+	query := r.URL.Query()
+	p := &searchParser{query, true}
+
+	filters := appDB.SearchFilters{
+		From:           p.time("from", false),
+		To:             p.time("to", true),
+		Camera:         query.Get("camera"),
+		Model:          query.Get("model"),
+		Lens:           query.Get("lens"),
+		IsoMin:         p.int("isoMin"),
+		IsoMax:         p.int("isoMax"),
+		FNumberMin:     p.float("fNumberMin"),
+		FNumberMax:     p.float("fNumberMax"),
+		FocalLengthMin: p.float("focalLengthMin"),
+		FocalLengthMax: p.float("focalLengthMax"),
+		MimeType:       query.Get("mime"),
+		Type:           query.Get("type"),
+		HasGPS:         p.bool("hasGps"),
+		Name:           query.Get("name"),
+		Album:          query.Get("album"),
+		Query:          strings.TrimSpace(query.Get("q")),
+		Cursor:         query.Get("cursor"),
+	}
+
+	switch query.Get("match") {
+	case "", "all":
+	case "any":
+		filters.MatchAny = true
+	default:
+		p.ok = false
+	}
+
+	limit := p.int("limit")
+	filters.Limit = int(limit.Int64)
+
+	return filters, p.ok
+}
+
+func searchFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	filters, ok := searchFilters(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, result, err := appDB.SearchFiles(userID, filters, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(result)
+	jsonResponse(w, status, string(response))
+}
+
+func fetchSearchFacetsRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	filters, ok := searchFilters(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, facets, err := appDB.GetSearchFacets(userID, filters, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(facets)
+	jsonResponse(w, status, string(response))
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local keeps objects as files in a directory on the local disk
+type Local struct {
+	dir string
+}
+
+// NewLocal creates the directory when it doesn't exist
+func NewLocal(dir string) (*Local, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir}, nil
+}
+
+// path converts the key into a path inside the directory. Keys escaping it are rejected
+func (l *Local) path(key string) (string, error) {
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if key == "" || !strings.HasPrefix(path, l.dir+string(filepath.Separator)) {
+		return "", errors.New("storage: invalid key " + key)
+	}
+
+	return path, nil
+}
+
+// Put writes to a temporary file first so readers never see a partially written object
+func (l *Local) Put(key string, data io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens the file
+func (l *Local) Get(key string) (io.ReadSeekCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotExist
+	}
+
+	return f, err
+}
+
+// Stat returns size and modification time of the file
+func (l *Local) Stat(key string) (Info, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+
+	stat, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotExist
+	}
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+// Delete removes the file
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Move renames the file, it's atomic within the directory
+func (l *Local) Move(src, dst string) error {
+	srcPath, err := l.path(src)
+	if err != nil {
+		return err
+	}
+
+	dstPath, err := l.path(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+
+	err = os.Rename(srcPath, dstPath)
+	if os.IsNotExist(err) {
+		return ErrNotExist
+	}
+
+	return err
+}
+
+// globEscaper makes a key prefix match literally in a glob pattern
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// List returns files whose keys start with the prefix. Only entries of the prefix's directory
+// which start with the rest of it are walked, not the whole storage
+func (l *Local) List(prefix string) ([]Info, error) {
+	objects := []Info{}
+	dir, name := path.Split(prefix)
+	root := filepath.Join(l.dir, filepath.FromSlash(dir))
+	if root != l.dir && !strings.HasPrefix(root, l.dir+string(filepath.Separator)) {
+		return objects, errors.New("storage: invalid prefix " + prefix)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(root, globEscaper.Replace(name)+"*"))
+	if err != nil {
+		return objects, err
+	}
+
+	for _, match := range matches {
+		err := filepath.Walk(match, func(path string, stat os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if stat.IsDir() || strings.HasPrefix(stat.Name(), ".upload-") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(l.dir, path)
+			if err != nil {
+				return err
+			}
+
+			key := filepath.ToSlash(rel)
+			if strings.HasPrefix(key, prefix) {
+				objects = append(objects, Info{Key: key, Size: stat.Size(), ModTime: stat.ModTime()})
+			}
+
+			return nil
+		})
+		if err != nil {
+			return objects, err
+		}
+	}
+
+	return objects, nil
+}
+
+// PresignedURL isn't supported, files on the local disk are served by the app
+func (l *Local) PresignedURL(key string, expires time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 keeps objects in a bucket of an S3-compatible service (AWS, MinIO, ...)
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// S3Config holds connection details of an S3-compatible service
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// NewS3 connects to the service and creates the bucket when it doesn't exist
+func NewS3(config S3Config) (*S3, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3{client: client, bucket: config.Bucket}, nil
+}
+
+func isNotExist(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+// Put uploads the object
+func (s *S3) Put(key string, data io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(
+		context.Background(),
+		s.bucket,
+		key,
+		data,
+		size,
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+
+	return err
+}
+
+// Get opens the object. It is fetched lazily, so Stat is called to report missing objects now
+func (s *S3) Get(key string) (io.ReadSeekCloser, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isNotExist(err) {
+			return nil, ErrNotExist
+		}
+
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// Stat returns size and modification time of the object
+func (s *S3) Stat(key string) (Info, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotExist(err) {
+			return Info{}, ErrNotExist
+		}
+
+		return Info{}, err
+	}
+
+	return Info{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// Delete removes the object. S3 doesn't report missing objects
+func (s *S3) Delete(key string) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// Move copies the object on the service side and removes the source. S3 has no rename
+func (s *S3) Move(src, dst string) error {
+	_, err := s.client.CopyObject(
+		context.Background(),
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: src},
+	)
+	if err != nil {
+		if isNotExist(err) {
+			return ErrNotExist
+		}
+
+		return err
+	}
+
+	return s.Delete(src)
+}
+
+// List returns objects whose keys start with the prefix
+func (s *S3) List(prefix string) ([]Info, error) {
+	objects := []Info{}
+	options := minio.ListObjectsOptions{Prefix: prefix, Recursive: true}
+
+	for object := range s.client.ListObjects(context.Background(), s.bucket, options) {
+		if object.Err != nil {
+			return objects, object.Err
+		}
+
+		objects = append(objects, Info{Key: object.Key, Size: object.Size, ModTime: object.LastModified})
+	}
+
+	return objects, nil
+}
+
+// PresignedURL returns a temporary URL for downloading the object directly from the service
+func (s *S3) PresignedURL(key string, expires time.Duration) (string, error) {
+	url, err := s.client.PresignedGetObject(context.Background(), s.bucket, key, expires, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return url.String(), nil
+}
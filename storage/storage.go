@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotExist is returned when there is no object under the key
+var ErrNotExist = errors.New("storage: object doesn't exist")
+
+// ErrPresignNotSupported is returned by drivers which can't hand out direct URLs
+var ErrPresignNotSupported = errors.New("storage: presigned URLs are not supported")
+
+// StagingPrefix starts keys of objects which aren't committed yet. They are moved to
+// their final keys once everything else succeeded
+const StagingPrefix = "staging/"
+
+// Info describes a stored object
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage keeps originals and their renditions under keys derived from file hashes
+type Storage interface {
+	// Put stores the data under the key, replacing an existing object
+	Put(key string, data io.Reader, size int64, contentType string) error
+	// Get opens the object for reading. The caller has to close it
+	Get(key string) (io.ReadSeekCloser, error)
+	// Stat returns information about the object
+	Stat(key string) (Info, error)
+	// Delete removes the object. Removing not existing object isn't an error
+	Delete(key string) error
+	// Move renames the object, replacing an existing object under the destination key
+	Move(src, dst string) error
+	// List returns all objects whose keys start with the prefix
+	List(prefix string) ([]Info, error)
+	// PresignedURL returns an URL giving temporary access to the object without credentials
+	PresignedURL(key string, expires time.Duration) (string, error)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// testStorage checks behaviour every driver has to provide
+func testStorage(t *testing.T, s Storage) {
+	data := []byte("photo content")
+
+	err := s.Put("abc", bytes.NewReader(data), int64(len(data)), "image/jpeg")
+	if err != nil {
+		t.Fatalf("Put - error: %s", err)
+	}
+	s.Put("abc_mobile", bytes.NewReader(data[:5]), 5, "image/jpeg")
+	s.Put("def", bytes.NewReader(data), int64(len(data)), "image/jpeg")
+
+	f, err := s.Get("abc")
+	if err != nil {
+		t.Fatalf("Get - error: %s", err)
+	}
+	content, _ := ioutil.ReadAll(f)
+	f.Close()
+	if !bytes.Equal(content, data) {
+		t.Errorf("Get - %s, expected %s", content, data)
+	}
+
+	info, err := s.Stat("abc_mobile")
+	if err != nil || info.Size != 5 {
+		t.Errorf("Stat - size %d, expected %d - error: %s", info.Size, 5, err)
+	}
+
+	if _, err := s.Stat("missing"); err != ErrNotExist {
+		t.Errorf("Stat - error %s, expected %s", err, ErrNotExist)
+	}
+
+	if _, err := s.Get("missing"); err != ErrNotExist {
+		t.Errorf("Get - error %s, expected %s", err, ErrNotExist)
+	}
+
+	objects, err := s.List("abc")
+	if err != nil || len(objects) != 2 {
+		t.Errorf("List - %d, expected %d - error: %s", len(objects), 2, err)
+	}
+
+	if err := s.Move("def", "moved/def"); err != nil {
+		t.Errorf("Move - error: %s", err)
+	}
+	if _, err := s.Stat("def"); err != ErrNotExist {
+		t.Errorf("Move - source still exists")
+	}
+	if info, err := s.Stat("moved/def"); err != nil || info.Size != int64(len(data)) {
+		t.Errorf("Move - size %d, expected %d - error: %s", info.Size, len(data), err)
+	}
+	if objects, err := s.List("moved/d"); err != nil || len(objects) != 1 || objects[0].Key != "moved/def" {
+		t.Errorf("List - %v, expected %s - error: %s", objects, "moved/def", err)
+	}
+	if objects, err := s.List(""); err != nil || len(objects) != 3 {
+		t.Errorf("List - %d, expected %d - error: %s", len(objects), 3, err)
+	}
+	if objects, err := s.List("ab*"); err != nil || len(objects) != 0 {
+		t.Errorf("List - %d, expected %d - wildcards are literal - error: %s", len(objects), 0, err)
+	}
+	if err := s.Move("missing", "moved/missing"); err != ErrNotExist {
+		t.Errorf("Move - error %s, expected %s", err, ErrNotExist)
+	}
+
+	if err := s.Delete("abc"); err != nil {
+		t.Errorf("Delete - error: %s", err)
+	}
+	if _, err := s.Stat("abc"); err != ErrNotExist {
+		t.Errorf("Delete - object still exists")
+	}
+	if err := s.Delete("abc"); err != nil {
+		t.Errorf("Delete - missing object, error: %s", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorage(t, local)
+
+	if err := local.Put("../escape", bytes.NewReader(nil), 0, ""); err == nil {
+		t.Errorf("Put - key outside of the directory should be rejected")
+	}
+
+	if _, err := local.PresignedURL("def", time.Minute); err != ErrPresignNotSupported {
+		t.Errorf("PresignedURL - error %s, expected %s", err, ErrPresignNotSupported)
+	}
+}
+
+// TestS3 runs against a MinIO instance, e.g.
+// `docker run -p 9000:9000 minio/minio server /data` and S3_TEST_ENDPOINT=localhost:9000
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	s3, err := NewS3(S3Config{
+		Endpoint:  endpoint,
+		AccessKey: "minioadmin",
+		SecretKey: "minioadmin",
+		Bucket:    "photos-test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStorage(t, s3)
+
+	url, err := s3.PresignedURL("def", time.Minute)
+	if err != nil || url == "" {
+		t.Errorf("PresignedURL - error: %s", err)
+	}
+}
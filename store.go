@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+
+	"photos/storage"
+
+	"github.com/rs/zerolog/log"
+)
+
+// storageConnection picks a storage driver by `STORAGE` env: `local` (default) keeps files
+// in `STORAGE_DIR`, `s3` uses a bucket of an S3-compatible service
+func storageConnection() storage.Storage {
+	if os.Getenv("STORAGE") == "s3" {
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+		})
+		if err != nil {
+			panic(err)
+		}
+
+		log.Info().Str("storage", "s3").Str("bucket", os.Getenv("S3_BUCKET")).Msg("Connected successfully")
+
+		return s3
+	}
+
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = "./files/"
+	}
+
+	local, err := storage.NewLocal(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Info().Str("storage", "local").Str("dir", dir).Msg("Connected successfully")
+
+	return local
+}
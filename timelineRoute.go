@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// timelineOptions reads the page of the timeline from the query. It's false when the limit isn't a number
+func timelineOptions(r *http.Request) (appDB.TimelineOptions, bool) {
+	query := r.URL.Query()
+	options := appDB.TimelineOptions{
+		Group:    query.Get("group"),
+		TimeZone: query.Get("tz"),
+		Cursor:   query.Get("cursor"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil {
+			return options, false
+		}
+		options.Limit = value
+	}
+
+	return options, true
+}
+
+func fetchTimelineRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	options, ok := timelineOptions(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status, timeline, err := appDB.GetTimeline(userID, options, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(timeline)
+	jsonResponse(w, status, string(response))
+}
+
+func fetchTimelineBucketsRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	options, _ := timelineOptions(r)
+
+	status, buckets, err := appDB.GetTimelineBuckets(userID, options, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(buckets)
+	jsonResponse(w, status, string(response))
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+func fetchTokensRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	tokens, err := appDB.GetAPITokens(userID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch tokens")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func addNewTokenRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	type Payload struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	var payload Payload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse a new token")
+
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, token, err := appDB.CreateAPIToken(userID, payload.Name, payload.Scopes, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(token)
+	jsonResponse(w, status, string(response))
+}
+
+func revokeTokenRoute(w http.ResponseWriter, r *http.Request, p httprouter.Params, userID int) {
+	enableCors(&w)
+	status := appDB.RevokeAPIToken(p.ByName("id"), userID, db)
+
+	w.WriteHeader(status)
+}
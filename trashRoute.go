@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+type trashPayload struct {
+	ID []int `json:"id"`
+}
+
+// trashResponse responds with id of files which weren't processed or just with the status
+func trashResponse(w http.ResponseWriter, userID int, failed []int) {
+	if len(failed) > 0 {
+		response, err := json.Marshal(trashPayload{failed})
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse not processed files")
+			response, _ = json.Marshal(trashPayload{})
+		}
+
+		jsonResponse(w, http.StatusUnprocessableEntity, string(response))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func fetchTrashRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	files, err := appDB.GetTrash(userID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse the trash")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(files)
+}
+
+func restoreFilesRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	var payload trashPayload
+	err := json.NewDecoder(r.Body).Decode(&payload)
+
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse files' id to restore")
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	trashResponse(w, userID, appDB.RestoreFiles(payload.ID, userID, db))
+}
+
+// emptyTrashRoute permanently deletes files given in the body, or the whole trash when the body is empty
+func emptyTrashRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	var payload trashPayload
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("user", userID).Msg("Can't parse files' id to purge")
+
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(payload.ID) > 0 {
+		trashResponse(w, userID, appDB.PurgeFiles(payload.ID, userID, store, db))
+		return
+	}
+
+	notDeleted, err := appDB.EmptyTrash(userID, store, db)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	trashResponse(w, userID, notDeleted)
+}
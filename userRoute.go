@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	appDB "photos/db"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
+)
+
+func registerRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	enableCors(&w)
+	type Payload struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		Email     string `json:"email"`
+		Password  string `json:"password"`
+	}
+	var payload Payload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Error().Err(err).Caller().Msg("Can't parse a new user")
+
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, user, err := appDB.CreateUser(
+		payload.FirstName,
+		payload.LastName,
+		payload.Email,
+		payload.Password,
+		db,
+	)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(user)
+	jsonResponse(w, status, string(response))
+}
+
+func loginRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	enableCors(&w)
+	type Payload struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	var payload Payload
+
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		log.Error().Err(err).Caller().Msg("Can't parse credentials")
+
+		jsonResponse(w, http.StatusBadRequest, "")
+		return
+	}
+
+	status, token, err := appDB.Login(payload.Email, payload.Password, db)
+	if err != nil {
+		jsonResponse(w, status, errorMessage(err))
+		return
+	}
+
+	response, _ := json.Marshal(map[string]string{"token": token})
+	jsonResponse(w, status, string(response))
+}
+
+func logoutRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	err := appDB.Logout(bearerToken(r), userID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't remove a session")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func fetchUserRoute(w http.ResponseWriter, r *http.Request, _ httprouter.Params, userID int) {
+	enableCors(&w)
+	user, err := appDB.GetUser(userID, db)
+	if err != nil {
+		log.Error().Err(err).Caller().Int("user", userID).Msg("Can't fetch the user")
+
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
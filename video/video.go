@@ -0,0 +1,241 @@
+package video
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	model "photos/model"
+
+	"github.com/h2non/filetype"
+	"gopkg.in/guregu/null.v3"
+)
+
+// PreviewName is the name of the low resolution transcode
+const PreviewName = "preview"
+
+// PreviewMimeType is the type of the low resolution transcode
+const PreviewMimeType = "video/mp4"
+
+// previewHeight is the height of the low resolution transcode
+const previewHeight = 480
+
+// Timeouts stop ffprobe and ffmpeg which take unreasonably long, e.g. on a malformed container
+const (
+	probeTimeout     = time.Minute
+	posterTimeout    = time.Minute
+	transcodeTimeout = 30 * time.Minute
+)
+
+var ffmpegPath = "ffmpeg"
+var ffprobePath = "ffprobe"
+
+// acceptedTypes maps accepted MIME types to extensions of stored originals
+var acceptedTypes = map[string]string{
+	"video/mp4":        "mp4",
+	"video/quicktime":  "mov",
+	"video/x-matroska": "mkv",
+}
+
+// iso6709 matches a location like `+52.2297+021.0122/` at least to latitude and longitude
+var iso6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)`)
+
+// Configure sets paths of ffmpeg and ffprobe binaries. Empty paths are looked up in PATH
+func Configure(ffmpeg, ffprobe string) {
+	if ffmpeg != "" {
+		ffmpegPath = ffmpeg
+	}
+	if ffprobe != "" {
+		ffprobePath = ffprobe
+	}
+}
+
+// SniffType detects a video from its content. It returns the MIME type, the extension
+// and whether the type is accepted
+func SniffType(data []byte) (string, string, bool) {
+	kind, err := filetype.Match(data)
+	if err != nil || kind == filetype.Unknown {
+		return "", "", false
+	}
+
+	extension, ok := acceptedTypes[kind.MIME.Value]
+
+	return kind.MIME.Value, extension, ok
+}
+
+type probeStream struct {
+	CodecType    string            `json:"codec_type"`
+	CodecName    string            `json:"codec_name"`
+	Width        int64             `json:"width"`
+	Height       int64             `json:"height"`
+	Tags         map[string]string `json:"tags"`
+	SideDataList []struct {
+		Rotation int `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+type probeResult struct {
+	Streams []probeStream `json:"streams"`
+	Format  struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// rotation returns how the player rotates the video, from the display matrix or the old `rotate` tag
+func rotation(stream probeStream) int {
+	for _, data := range stream.SideDataList {
+		if data.Rotation != 0 {
+			return data.Rotation
+		}
+	}
+
+	degrees, _ := strconv.Atoi(stream.Tags["rotate"])
+
+	return degrees
+}
+
+// parseLocation reads latitude and longitude from an ISO 6709 string
+func parseLocation(value string) (null.Float, null.Float) {
+	match := iso6709.FindStringSubmatch(value)
+	if match == nil {
+		return null.Float{}, null.Float{}
+	}
+
+	lat, latErr := strconv.ParseFloat(match[1], 64)
+	long, longErr := strconv.ParseFloat(match[2], 64)
+	if latErr != nil || longErr != nil {
+		return null.Float{}, null.Float{}
+	}
+
+	return null.FloatFrom(lat), null.FloatFrom(long)
+}
+
+// ExtractMetadata reads duration, codec, resolution, creation time and GPS location
+// from the container with ffprobe
+func ExtractMetadata(path string) (model.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	output, err := run(
+		ctx,
+		ffprobePath,
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	)
+	if err != nil {
+		return model.File{}, err
+	}
+
+	var probe probeResult
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return model.File{}, err
+	}
+
+	file := model.File{}
+	if duration, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		file.Duration = null.FloatFrom(duration)
+	}
+
+	tags := probe.Format.Tags
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+
+		width, height := stream.Width, stream.Height
+		if degrees := rotation(stream); degrees%180 != 0 {
+			width, height = height, width
+		}
+
+		file.Codec = null.StringFrom(stream.CodecName)
+		file.Width = null.IntFrom(width)
+		file.Height = null.IntFrom(height)
+		if tags["creation_time"] == "" {
+			tags = stream.Tags
+		}
+		break
+	}
+
+	if created, err := time.Parse(time.RFC3339Nano, tags["creation_time"]); err == nil {
+		file.Date = null.TimeFrom(created)
+	}
+
+	location := probe.Format.Tags["com.apple.quicktime.location.ISO6709"]
+	if location == "" {
+		location = probe.Format.Tags["location"]
+	}
+	file.Latitude, file.Longitude = parseLocation(location)
+
+	return file, nil
+}
+
+// Poster returns a JPEG frame from the first second of the video, or its middle when it's shorter
+func Poster(path string, duration float64) ([]byte, error) {
+	position := 1.0
+	if duration > 0 && duration < 2 {
+		position = duration / 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), posterTimeout)
+	defer cancel()
+
+	return run(
+		ctx,
+		ffmpegPath,
+		"-v", "error",
+		"-ss", strconv.FormatFloat(position, 'f', 3, 64),
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"pipe:1",
+	)
+}
+
+// Preview transcodes the video to a low resolution MP4 which starts playing before it's downloaded
+func Preview(path, destination string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transcodeTimeout)
+	defer cancel()
+
+	_, err := run(
+		ctx,
+		ffmpegPath,
+		"-v", "error",
+		"-y",
+		"-i", path,
+		"-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", previewHeight),
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "28",
+		"-c:a", "aac",
+		"-b:a", "96k",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		destination,
+	)
+
+	return err
+}
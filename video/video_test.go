@@ -0,0 +1,50 @@
+package video
+
+import "testing"
+
+func TestParseLocation(t *testing.T) {
+	cases := []struct {
+		value     string
+		valid     bool
+		latitude  float64
+		longitude float64
+	}{
+		{"+52.2297+021.0122/", true, 52.2297, 21.0122},
+		{"-33.8688+151.2093+058.000/", true, -33.8688, 151.2093},
+		{"+40-074/", true, 40, -74},
+		{"", false, 0, 0},
+		{"52.2297, 21.0122", false, 0, 0},
+	}
+
+	for _, c := range cases {
+		lat, long := parseLocation(c.value)
+		if lat.Valid != c.valid || long.Valid != c.valid {
+			t.Errorf("parseLocation(%q) - valid %t, expected %t", c.value, lat.Valid, c.valid)
+			continue
+		}
+		if lat.Float64 != c.latitude || long.Float64 != c.longitude {
+			t.Errorf(
+				"parseLocation(%q) = %f, %f; want `%f, %f`",
+				c.value,
+				lat.Float64,
+				long.Float64,
+				c.latitude,
+				c.longitude,
+			)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	stream := probeStream{Tags: map[string]string{"rotate": "90"}}
+	if degrees := rotation(stream); degrees != 90 {
+		t.Errorf("rotation = %d; want `%d` - rotate tag", degrees, 90)
+	}
+
+	stream.SideDataList = append(stream.SideDataList, struct {
+		Rotation int `json:"rotation"`
+	}{-90})
+	if degrees := rotation(stream); degrees != -90 {
+		t.Errorf("rotation = %d; want `%d` - display matrix", degrees, -90)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	appDB "photos/db"
+	"photos/geocode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// defaultWorkers is how many files are processed at once when JOB_WORKERS isn't set
+const defaultWorkers = 2
+
+// jobPollInterval is how long an idle worker waits before checking for new jobs
+const jobPollInterval = 2 * time.Second
+
+// workersCount reads the number of workers from JOB_WORKERS
+func workersCount() int {
+	count := defaultWorkers
+	if value := os.Getenv("JOB_WORKERS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			log.Warn().Str("value", value).Int("default", count).Msg("Invalid JOB_WORKERS, using the default")
+		} else {
+			count = parsed
+		}
+	}
+
+	return count
+}
+
+// placesBatchSize is how many files are named at once when places are named in the background
+const placesBatchSize = 100
+
+// placesRetryDelay is how long naming places waits after the service failed
+const placesRetryDelay = time.Hour
+
+// geocoderConfig sets up naming places where photos were taken from `GEOCODER_URL`, a Nominatim
+// compatible service, `GEOCODER_LANGUAGE` of the names and `GEOCODER_USER_AGENT` identifying
+// requests, e.g. `photos (admin@example.com)`. Places aren't named without the URL
+func geocoderConfig() {
+	geocode.Configure(os.Getenv("GEOCODER_URL"), os.Getenv("GEOCODER_LANGUAGE"), os.Getenv("GEOCODER_USER_AGENT"))
+}
+
+// nameMissingPlaces names places of files processed before geocoding was set up or while the
+// service failed. Every file is visited once after the start, it stops when all were visited
+func nameMissingPlaces() {
+	if !geocode.Enabled() {
+		return
+	}
+
+	after := int64(0)
+	total := 0
+	for {
+		last, named, err := appDB.NameMissingPlaces(after, placesBatchSize, db)
+		total += named
+		if err != nil {
+			log.Error().Err(err).Caller().Int64("after", last).Msg("Can't name places, retrying later")
+			time.Sleep(placesRetryDelay)
+		}
+		if err == nil && last == after {
+			break
+		}
+
+		after = last
+	}
+
+	if total > 0 {
+		log.Info().Int("named", total).Msg("Places of files named")
+	}
+}
+
+// processJobs runs queued jobs one by one until the program exits. It sleeps only
+// when the queue is empty, so a backlog is drained as fast as possible
+func processJobs(worker int) {
+	for {
+		processed, err := appDB.RunNextJob(store, db)
+		if err != nil {
+			log.Error().Err(err).Caller().Int("worker", worker).Msg("Can't run a job")
+		}
+
+		if !processed || err != nil {
+			time.Sleep(jobPollInterval)
+		}
+	}
+}
+
+// startWorkers starts the pool processing uploaded files
+func startWorkers(count int) {
+	for i := 0; i < count; i++ {
+		go processJobs(i)
+	}
+
+	log.Info().Int("workers", count).Msg("Workers started")
+}